@@ -27,8 +27,6 @@ import (
 )
 
 var (
-	globalRowId           = 0
-	globalPartition       = 0
 	subscriptionId        = ""
 	resourceGroupName     = ""
 	resourceGroupLocation = ""
@@ -147,12 +145,14 @@ func CreateDB(context context.Context) {
 	}
 	log.Println("Cosmos database account:", *databaseAccount.ID)
 
-	log.Println("Creating new table ...")
-	table, err := createTable(context, tableResourcesClient)
-	if err != nil {
-		log.Fatal(err)
+	for _, name := range []string{tableName, FeedStateTable, FeedsTable, DedupTable} {
+		log.Println("Creating new table", name, "...")
+		table, err := createTable(context, tableResourcesClient, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Cosmos table:", *table.ID)
 	}
-	log.Println("Cosmos table:", *table.ID)
 }
 
 func createDatabaseAccount(context context.Context, client *armcosmos.DatabaseAccountsClient) (*armcosmos.DatabaseAccountGetResults, error) {
@@ -193,17 +193,17 @@ func createDatabaseAccount(context context.Context, client *armcosmos.DatabaseAc
 	return &resp.DatabaseAccountGetResults, nil
 }
 
-func createTable(context context.Context, client *armcosmos.TableResourcesClient) (*armcosmos.TableGetResults, error) {
+func createTable(context context.Context, client *armcosmos.TableResourcesClient, name string) (*armcosmos.TableGetResults, error) {
 	pollerResp, err := client.BeginCreateUpdateTable(
 		context,
 		resourceGroupName,
 		accountName,
-		tableName,
+		name,
 		armcosmos.TableCreateUpdateParameters{
 			Location: to.Ptr(resourceGroupLocation),
 			Properties: &armcosmos.TableCreateUpdateProperties{
 				Resource: &armcosmos.TableResource{
-					ID: to.Ptr(tableName),
+					ID: to.Ptr(name),
 				},
 				Options: &armcosmos.CreateUpdateOptions{},
 			},
@@ -246,21 +246,7 @@ func GetTable(credential azcore.TokenCredential, tableAccountEndpoint string, ta
 }
 
 func InsertData(context context.Context, table *aztables.Client, item News) error {
-	entity := aztables.EDMEntity{
-		Entity: aztables.Entity{
-			RowKey:       strconv.Itoa(globalRowId), // TODO: need to be changed: after first run it will override existing data
-			PartitionKey: "id",                      // globalPartition
-		},
-		Properties: map[string]any{
-			"Title":       item.Title,
-			"Description": item.Description,
-			"Date":        aztables.EDMDateTime(item.Date),
-		},
-	}
-	globalRowId += 1
-	globalPartition = (globalPartition + 1) % 5
-
-	bytes, err := json.Marshal(entity)
+	bytes, err := newsEntity(item)
 	if err != nil {
 		return err
 	}
@@ -272,6 +258,98 @@ func InsertData(context context.Context, table *aztables.Client, item News) erro
 	return nil
 }
 
+// Entity group transactions take at most 100 entities; Cosmos DB also
+// caps the request at 2 MB.
+const (
+	maxBatchEntities = 100
+	maxBatchBytes    = 2 * 1024 * 1024
+)
+
+// InsertDataBatch upserts items with one entity group transaction per
+// partition key and chunk of up to 100 entities. When a transaction is
+// rejected its entities are retried one by one, so that a single bad entity
+// is reported on its own. Failures are returned as a *BatchError.
+func InsertDataBatch(context context.Context, table *aztables.Client, items []News) error {
+	batchErr := &BatchError{}
+	partitions := map[string][]transactionEntity{}
+	var order []string
+	for _, item := range items {
+		partitionKey, rowKey := NewsKeys(item)
+		bytes, err := newsEntity(item)
+		if err != nil {
+			batchErr.add(item, err)
+			continue
+		}
+		if _, ok := partitions[partitionKey]; !ok {
+			order = append(order, partitionKey)
+		}
+		partitions[partitionKey] = appendEntity(partitions[partitionKey], transactionEntity{Item: item, RowKey: rowKey, Data: bytes})
+	}
+
+	for _, partitionKey := range order {
+		for _, chunk := range chunkEntities(partitions[partitionKey]) {
+			actions := make([]aztables.TransactionAction, 0, len(chunk))
+			for _, entity := range chunk {
+				actions = append(actions, aztables.TransactionAction{
+					ActionType: aztables.TransactionTypeInsertReplace,
+					Entity:     entity.Data,
+				})
+			}
+			_, err := table.SubmitTransaction(context, actions, nil)
+			if err == nil {
+				continue
+			}
+			for _, entity := range chunk {
+				_, err := table.UpsertEntity(context, entity.Data, nil)
+				if err != nil {
+					batchErr.add(entity.Item, err)
+				}
+			}
+		}
+	}
+
+	if len(batchErr.Failures) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+type transactionEntity struct {
+	Item   News
+	RowKey string
+	Data   []byte
+}
+
+// appendEntity adds entity, replacing an earlier one with the same row key,
+// as a transaction may touch each row only once.
+func appendEntity(entities []transactionEntity, entity transactionEntity) []transactionEntity {
+	for i := range entities {
+		if entities[i].RowKey == entity.RowKey {
+			entities[i] = entity
+			return entities
+		}
+	}
+	return append(entities, entity)
+}
+
+func chunkEntities(entities []transactionEntity) [][]transactionEntity {
+	var chunks [][]transactionEntity
+	var chunk []transactionEntity
+	size := 0
+	for _, entity := range entities {
+		if len(chunk) == maxBatchEntities || (len(chunk) > 0 && size+len(entity.Data) > maxBatchBytes) {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, entity)
+		size += len(entity.Data)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
 type BearerTokenResponse struct {
 	Type         string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"`
@@ -345,6 +423,26 @@ func createStorageAccount(ctx context.Context, location string) (string, string)
 	return *res.Name, connString
 }
 
+// createQueues creates the ingestion queues on the storage account used by
+// the function app.
+func createQueues(ctx context.Context, storageAccountName string) {
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	clientFactory, err := armstorage.NewClientFactory(subscriptionId, credential, nil)
+	if err != nil {
+		log.Fatalf("failed to create client: %v", err)
+	}
+	client := clientFactory.NewQueueClient()
+	for _, name := range []string{IngestQueue, IngestPoisonQueue} {
+		_, err := client.Create(ctx, resourceGroupName, storageAccountName, name, armstorage.Queue{}, nil)
+		if err != nil {
+			log.Fatalf("failed to create queue %s: %v", name, err)
+		}
+	}
+}
+
 func createAppPlan(ctx context.Context, location string) string {
 	planName := "fplan" + strconv.Itoa(randRange(100000, 999999)) + "jb"
 
@@ -443,6 +541,8 @@ func updateCors(ctx context.Context, appName string, origins []*string) error {
 func CreateResources(ctx context.Context, location string) string {
 	storageAccountName, connString := createStorageAccount(ctx, location)
 	fmt.Printf("Storage account: %v\n", storageAccountName)
+	createQueues(ctx, storageAccountName)
+	fmt.Printf("Queues: %v, %v\n", IngestQueue, IngestPoisonQueue)
 	functionPlanId := createAppPlan(ctx, location)
 	fmt.Printf("Function app plan id: %v\n", functionPlanId)
 	functionAppName := createFunctionApp(ctx, location, functionPlanId, connString)
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// xmlDeclaration matches the XML declaration and captures its encoding.
+var xmlDeclaration = regexp.MustCompile(`^\s*<\?xml[^>]*?\bencoding\s*=\s*["']([A-Za-z0-9._:-]+)["'][^>]*\?>`)
+
+// DecodeCharset returns data as UTF-8. The charset is taken from a byte
+// order mark, else from the XML declaration, else from the charset
+// parameter of contentType; servers often send a default charset that the
+// document contradicts. A document declared UTF-8 that is not valid UTF-8
+// is read in the charset of contentType instead. The encoding of the XML
+// declaration is rewritten to UTF-8, so that encoding/xml accepts the
+// result.
+func DecodeCharset(contentType string, data []byte) ([]byte, error) {
+	if enc, size := bomEncoding(data); enc != nil {
+		decoded, err := enc.NewDecoder().Bytes(data[size:])
+		if err != nil {
+			return nil, fmt.Errorf("decoding feed: %w", err)
+		}
+		return declareUTF8(decoded), nil
+	}
+
+	label := ""
+	if match := xmlDeclaration.FindSubmatch(data); match != nil {
+		label = string(match[1])
+	}
+	_, params, _ := mime.ParseMediaType(contentType)
+	headerLabel := strings.Trim(params["charset"], `"' `)
+	if label == "" || (isUTF8Label(label) && !utf8.Valid(data) && headerLabel != "") {
+		label = headerLabel
+	}
+	if label == "" || isUTF8Label(label) {
+		return declareUTF8(data), nil
+	}
+
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding feed from %s: %w", label, err)
+	}
+	return declareUTF8(decoded), nil
+}
+
+func isUTF8Label(label string) bool {
+	return strings.EqualFold(label, "utf-8") || strings.EqualFold(label, "utf8")
+}
+
+// bomEncoding returns the encoding announced by a byte order mark of data
+// and the size of the mark.
+func bomEncoding(data []byte) (encoding.Encoding, int) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		return unicode.UTF8, 3
+	case bytes.HasPrefix(data, []byte("\xfe\xff")):
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), 2
+	case bytes.HasPrefix(data, []byte("\xff\xfe")):
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), 2
+	}
+	return nil, 0
+}
+
+// declareUTF8 rewrites the encoding of the XML declaration of data, if
+// any, to UTF-8.
+func declareUTF8(data []byte) []byte {
+	match := xmlDeclaration.FindSubmatchIndex(data)
+	if match == nil {
+		return data
+	}
+	label := data[match[2]:match[3]]
+	if string(label) == "UTF-8" {
+		return data
+	}
+	rewritten := make([]byte, 0, len(data))
+	rewritten = append(rewritten, data[:match[2]]...)
+	rewritten = append(rewritten, "UTF-8"...)
+	return append(rewritten, data[match[3]:]...)
+}
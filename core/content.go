@@ -0,0 +1,267 @@
+package core
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Content is an item description made safe to render: HTML keeps only
+// allowlisted tags and attributes, Text is the readable text of it, Image
+// the first image and WordCount the number of words of Text.
+type Content struct {
+	HTML      string
+	Text      string
+	Image     string
+	WordCount int
+}
+
+// allowedTags are kept with the listed attributes; other tags are removed
+// but their content is kept, except for droppedTags.
+var allowedTags = map[atom.Atom][]string{
+	atom.A: {"href", "title"}, atom.Abbr: {"title"}, atom.B: nil, atom.Blockquote: {"cite"},
+	atom.Br: nil, atom.Caption: nil, atom.Cite: nil, atom.Code: nil, atom.Dd: nil, atom.Del: nil,
+	atom.Div: nil, atom.Dl: nil, atom.Dt: nil, atom.Em: nil, atom.Figcaption: nil, atom.Figure: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Hr: nil, atom.I: nil, atom.Img: {"src", "alt", "title", "width", "height"}, atom.Ins: nil,
+	atom.Li: nil, atom.Mark: nil, atom.Ol: nil, atom.P: nil, atom.Pre: nil, atom.Q: {"cite"},
+	atom.S: nil, atom.Small: nil, atom.Span: nil, atom.Strong: nil, atom.Sub: nil, atom.Sup: nil,
+	atom.Table: nil, atom.Tbody: nil, atom.Td: {"colspan", "rowspan"}, atom.Tfoot: nil,
+	atom.Th: {"colspan", "rowspan"}, atom.Thead: nil, atom.Tr: nil, atom.U: nil, atom.Ul: nil,
+}
+
+// droppedTags are removed together with their content.
+var droppedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Noscript: true, atom.Template: true, atom.Form: true, atom.Input: true, atom.Button: true,
+	atom.Select: true, atom.Textarea: true, atom.Svg: true, atom.Math: true, atom.Head: true,
+	atom.Title: true, atom.Meta: true, atom.Link: true, atom.Base: true, atom.Frame: true,
+	atom.Frameset: true, atom.Applet: true, atom.Audio: true, atom.Video: true,
+}
+
+// blockTags separate lines of the plain text.
+var blockTags = map[atom.Atom]bool{
+	atom.Blockquote: true, atom.Br: true, atom.Caption: true, atom.Dd: true, atom.Div: true,
+	atom.Dl: true, atom.Dt: true, atom.Figcaption: true, atom.Figure: true, atom.H1: true,
+	atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true,
+	atom.Li: true, atom.Ol: true, atom.P: true, atom.Pre: true, atom.Table: true, atom.Tr: true,
+	atom.Ul: true,
+}
+
+// ProcessContent sanitizes the HTML description raw of an item. Relative
+// links and images are resolved against base, the item link; links other
+// than http(s) and mailto, images other than http(s) and tracking pixels
+// are removed.
+func ProcessContent(raw, base string) Content {
+	baseURL, _ := url.Parse(base)
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(raw), context)
+	if err != nil {
+		// The tokenizer accepts any input; only a failing reader errors.
+		return Content{Text: strings.TrimSpace(raw), WordCount: len(strings.Fields(raw))}
+	}
+
+	sanitizer := sanitizer{base: baseURL}
+	for _, node := range nodes {
+		sanitizer.walk(node)
+	}
+	text := sanitizer.plainText()
+	return Content{
+		HTML:      strings.TrimSpace(sanitizer.html.String()),
+		Text:      text,
+		Image:     sanitizer.image,
+		WordCount: len(strings.Fields(text)),
+	}
+}
+
+// withContent replaces the raw description of item by its sanitized HTML
+// and fills the fields derived from it. ParseFeed applies it to new items,
+// NewsFromEntity to items stored before schema version 4.
+func withContent(item News) News {
+	content := ProcessContent(item.Description, item.Link)
+	item.Description = content.HTML
+	item.DescriptionText = content.Text
+	item.WordCount = content.WordCount
+	item.Image = content.Image
+	if item.Image == "" {
+		base, _ := url.Parse(item.Link)
+		item.Image = resolveURL(base, firstImage(item.Media), false)
+	}
+	return item
+}
+
+type sanitizer struct {
+	base  *url.URL
+	html  strings.Builder
+	text  strings.Builder
+	image string
+	pre   int
+}
+
+func (s *sanitizer) walk(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		s.html.WriteString(html.EscapeString(node.Data))
+		text := node.Data
+		if s.pre == 0 {
+			// Outside <pre> line breaks of the source are spaces.
+			text = strings.Map(func(r rune) rune {
+				if r == '\n' || r == '\r' || r == '\t' {
+					return ' '
+				}
+				return r
+			}, text)
+		}
+		s.text.WriteString(text)
+		return
+	case html.ElementNode:
+	default:
+		// Comments and doctypes are dropped; documents walk their children.
+		if node.Type == html.DocumentNode {
+			s.children(node)
+		}
+		return
+	}
+
+	if droppedTags[node.DataAtom] {
+		return
+	}
+	allowed, ok := allowedTags[node.DataAtom]
+	if !ok {
+		s.children(node)
+		return
+	}
+	if node.DataAtom == atom.Img && trackingPixel(node) {
+		return
+	}
+
+	var attrs []html.Attribute
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" || !slices.Contains(allowed, attr.Key) {
+			continue
+		}
+		switch attr.Key {
+		case "href", "src", "cite":
+			resolved := resolveURL(s.base, attr.Val, node.DataAtom == atom.A && attr.Key == "href")
+			if resolved == "" {
+				continue
+			}
+			attr.Val = resolved
+		}
+		attrs = append(attrs, attr)
+	}
+	if node.DataAtom == atom.Img {
+		src := attrValue(attrs, "src")
+		if src == "" {
+			return
+		}
+		if s.image == "" {
+			s.image = src
+		}
+	}
+	if node.DataAtom == atom.A {
+		attrs = append(attrs, html.Attribute{Key: "rel", Val: "nofollow noopener noreferrer"})
+	}
+
+	block := blockTags[node.DataAtom]
+	if block {
+		s.text.WriteByte('\n')
+	}
+	s.html.WriteByte('<')
+	s.html.WriteString(node.Data)
+	for _, attr := range attrs {
+		s.html.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	s.html.WriteByte('>')
+	if isVoid(node.DataAtom) {
+		return
+	}
+	if node.DataAtom == atom.Pre {
+		s.pre++
+	}
+	s.children(node)
+	if node.DataAtom == atom.Pre {
+		s.pre--
+	}
+	s.html.WriteString("</" + node.Data + ">")
+	if block {
+		s.text.WriteByte('\n')
+	}
+}
+
+func (s *sanitizer) children(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		s.walk(child)
+	}
+}
+
+// resolveURL returns the absolute form of ref resolved against base, or ""
+// when ref is empty or its scheme is not allowed. mailto is allowed for
+// links only.
+func resolveURL(base *url.URL, ref string, link bool) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil && base.IsAbs() {
+		parsed = base.ResolveReference(parsed)
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		if parsed.Host == "" {
+			return ""
+		}
+		return parsed.String()
+	case "mailto":
+		if link {
+			return parsed.String()
+		}
+	}
+	return ""
+}
+
+// trackingPixel reports whether img is a hidden or 1x1 image, as used to
+// count readers.
+func trackingPixel(img *html.Node) bool {
+	tiny := func(value string) bool {
+		value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+		return value == "0" || value == "1"
+	}
+	if tiny(attrValue(img.Attr, "width")) || tiny(attrValue(img.Attr, "height")) {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(attrValue(img.Attr, "style")), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// plainText returns the text, one line per block, with whitespace
+// collapsed.
+func (s *sanitizer) plainText() string {
+	var lines []string
+	for _, line := range strings.Split(s.text.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func attrValue(attrs []html.Attribute, key string) string {
+	for _, attr := range attrs {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func isVoid(tag atom.Atom) bool {
+	return tag == atom.Br || tag == atom.Hr || tag == atom.Img
+}
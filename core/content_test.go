@@ -0,0 +1,161 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+const contentBase = "https://news.example.com/a/item.html"
+
+const rel = ` rel="nofollow noopener noreferrer"`
+
+func TestProcessContentRemovesScripts(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		html string
+	}{
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"javascript link in mixed case", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"javascript link with entities", `<a href=" java&#09;script:alert(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"vbscript link", `<a href="vbscript:msgbox(1)">x</a>`, `<a` + rel + `>x</a>`},
+		{"data link", `<a href="data:text/html,<script>alert(1)</script>">x</a>`, `<a` + rel + `>x</a>`},
+		{"data image", `<img src="data:image/png;base64,AAAA">`, ``},
+		{"javascript image", `<img src="javascript:alert(1)">`, ``},
+		{"javascript cite", `<blockquote cite="javascript:alert(1)">q</blockquote>`, `<blockquote>q</blockquote>`},
+		{"event handlers", `<p onclick="alert(1)" onmouseover="alert(2)">hi</p>`, `<p>hi</p>`},
+		{"image event handler", `<img src="/a.png" onerror="alert(1)">`, `<img src="https://news.example.com/a.png">`},
+		{"style and class", `<p style="background:url(javascript:alert(1))" class="c" id="i">hi</p>`, `<p>hi</p>`},
+		{"script", `<script>alert(1)</script>text`, `text`},
+		{"style", `<style>body{display:none}</style>text`, `text`},
+		{"iframe", `<iframe src="https://evil.test/"></iframe>text`, `text`},
+		{"object and embed", `<object data="x.swf"><embed src="x.swf"></object>text`, `text`},
+		{"form", `<form action="https://evil.test/"><input name="p"><button>go</button></form>text`, `text`},
+		{"svg", `<svg onload="alert(1)"><script>alert(1)</script></svg>after`, `after`},
+		{"svg image", `<svg><image href="javascript:alert(1)"/></svg>after`, `after`},
+		{"math", `<math><mtext><img src=x onerror=alert(1)></mtext></math>after`, `after`},
+		{"unknown tag keeps text", `<font color="red"><custom-tag onclick="x">text</custom-tag></font>`, `text`},
+		{"comment", `<!-- <script>alert(1)</script> -->text`, `text`},
+		{"escaped markup stays text", `&lt;script&gt;alert(1)&lt;/script&gt;`, `&lt;script&gt;alert(1)&lt;/script&gt;`},
+		{"attribute quotes", `<a href="https://e.test/?q=&quot;&gt;&lt;script&gt;" title="a&quot;b">x</a>`, `<a href="https://e.test/?q=&#34;&gt;&lt;script&gt;" title="a&#34;b"` + rel + `>x</a>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := ProcessContent(test.raw, contentBase)
+			if content.HTML != test.html {
+				t.Errorf("ProcessContent(%s).HTML = %s, want %s", test.raw, content.HTML, test.html)
+			}
+			lower := strings.ToLower(content.HTML)
+			for _, banned := range []string{"<script", "javascript:", "data:", " on", "<svg", "<math", "<iframe"} {
+				if strings.Contains(lower, banned) {
+					t.Errorf("ProcessContent(%s).HTML = %s contains %q", test.raw, content.HTML, banned)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessContentURLs(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		html  string
+		image string
+	}{
+		{"relative link", `<a href="../b/c?x=1">x</a>`, `<a href="https://news.example.com/b/c?x=1"` + rel + `>x</a>`, ``},
+		{"root-relative image", `<img src="/i/p.jpg" alt="p">`, `<img src="https://news.example.com/i/p.jpg" alt="p">`, `https://news.example.com/i/p.jpg`},
+		{"relative image", `<img src="p.jpg">`, `<img src="https://news.example.com/a/p.jpg">`, `https://news.example.com/a/p.jpg`},
+		{"protocol-relative image", `<img src="//cdn.example.com/p.jpg">`, `<img src="https://cdn.example.com/p.jpg">`, `https://cdn.example.com/p.jpg`},
+		{"absolute link", `<a href="http://other.example.org/x">x</a>`, `<a href="http://other.example.org/x"` + rel + `>x</a>`, ``},
+		{"mailto link", `<a href="mailto:desk@example.com">x</a>`, `<a href="mailto:desk@example.com"` + rel + `>x</a>`, ``},
+		{"mailto image", `<img src="mailto:desk@example.com">`, ``, ``},
+		{"ftp link", `<a href="ftp://example.com/f">x</a>`, `<a` + rel + `>x</a>`, ``},
+		{"first image", `<img src="/1.jpg"><img src="/2.jpg">`, `<img src="https://news.example.com/1.jpg"><img src="https://news.example.com/2.jpg">`, `https://news.example.com/1.jpg`},
+		{"tracking pixel", `<img src="https://t.example/p.gif" width="1" height="1"><img src="/real.jpg">`, `<img src="https://news.example.com/real.jpg">`, `https://news.example.com/real.jpg`},
+		{"zero-size pixel", `<img src="https://t.example/p.gif" width="0px">`, ``, ``},
+		{"hidden pixel", `<img src="https://t.example/p.gif" style="display: none">`, ``, ``},
+		{"invisible pixel", `<img src="https://t.example/p.gif" style="visibility:hidden">`, ``, ``},
+		{"image without src", `<img alt="x">`, ``, ``},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := ProcessContent(test.raw, contentBase)
+			if content.HTML != test.html {
+				t.Errorf("ProcessContent(%s).HTML = %s, want %s", test.raw, content.HTML, test.html)
+			}
+			if content.Image != test.image {
+				t.Errorf("ProcessContent(%s).Image = %q, want %q", test.raw, content.Image, test.image)
+			}
+		})
+	}
+
+	// Without a usable base, relative urls cannot be resolved and are dropped.
+	if content := ProcessContent(`<a href="/x">x</a><img src="p.jpg">`, ""); content.HTML != `<a`+rel+`>x</a>` {
+		t.Errorf("ProcessContent without base = %s", content.HTML)
+	}
+}
+
+func TestProcessContentText(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		text  string
+		words int
+	}{
+		{"empty", ``, ``, 0},
+		{"plain", `Just   some
+text`, `Just some text`, 3},
+		{"blocks", `<h1>Title</h1><p>One two  three</p><ul><li>four</li><li>five</li></ul>six<br>seven`, "Title\nOne two three\nfour\nfive\nsix\nseven", 8},
+		{"inline", `<p>a <b>bold</b> and <a href="/x">link</a></p>`, `a bold and link`, 4},
+		{"entities", `Fish &amp; chips &lt;3`, `Fish & chips <3`, 4},
+		{"dropped content", `<script>var a = 1</script><style>p{}</style>visible`, `visible`, 1},
+		{"pre", "<pre>a\n  b</pre>", "a\nb", 2},
+		{"unicode", `<p>Zażółć gęślą jaźń</p>`, `Zażółć gęślą jaźń`, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := ProcessContent(test.raw, contentBase)
+			if content.Text != test.text {
+				t.Errorf("ProcessContent(%s).Text = %q, want %q", test.raw, content.Text, test.text)
+			}
+			if content.WordCount != test.words {
+				t.Errorf("ProcessContent(%s).WordCount = %d, want %d", test.raw, content.WordCount, test.words)
+			}
+		})
+	}
+}
+
+func TestWithContentMediaImage(t *testing.T) {
+	item := withContent(News{
+		Link:        contentBase,
+		Description: `<p>No image here</p>`,
+		Media:       []Media{{Rel: MediaRelEnclosure, URL: "https://cdn.example.com/a.mp3", Type: "audio/mpeg"}, {Rel: MediaRelThumbnail, URL: "https://cdn.example.com/t.jpg"}},
+	})
+	if item.Image != "https://cdn.example.com/t.jpg" {
+		t.Errorf("withContent Image = %q, want the media thumbnail", item.Image)
+	}
+	if item.DescriptionText != "No image here" || item.WordCount != 3 {
+		t.Errorf("withContent text = %q, %d words", item.DescriptionText, item.WordCount)
+	}
+}
+
+func TestWithContentMediaImageScheme(t *testing.T) {
+	tests := []struct {
+		url   string
+		image string
+	}{
+		{"javascript:alert(1)", ""},
+		{"JavaScript:alert(1)", ""},
+		{"data:image/svg+xml,<svg onload=alert(1)>", ""},
+		{"vbscript:msgbox(1)", ""},
+		{"mailto:desk@example.com", ""},
+		{"/i/t.jpg", "https://news.example.com/i/t.jpg"},
+		{"https://cdn.example.com/t.jpg", "https://cdn.example.com/t.jpg"},
+	}
+	for _, test := range tests {
+		item := withContent(News{Link: contentBase, Media: []Media{{Rel: MediaRelThumbnail, URL: test.url}}})
+		if item.Image != test.image {
+			t.Errorf("withContent with media %s: Image = %q, want %q", test.url, item.Image, test.image)
+		}
+	}
+}
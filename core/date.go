@@ -0,0 +1,172 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DateLayouts are tried in order by ParseDate. A leading weekday is removed
+// before matching, so the layouts do not contain one.
+var DateLayouts = []string{
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05 MST",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04 MST",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 Jan 2006",
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2 2006 15:04:05 MST",
+	"Jan 2 2006 15:04",
+	"Jan 2 2006",
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999-0700",
+	"2006-01-02T15:04-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Offsets of zone abbreviations allowed by RFC 822 and common in feeds.
+// time.Parse gives unknown abbreviations a zero offset.
+var zoneOffsets = map[string]int{
+	"EST":  -5 * 3600,
+	"EDT":  -4 * 3600,
+	"CST":  -6 * 3600,
+	"CDT":  -5 * 3600,
+	"MST":  -7 * 3600,
+	"MDT":  -6 * 3600,
+	"PST":  -8 * 3600,
+	"PDT":  -7 * 3600,
+	"CET":  1 * 3600,
+	"CEST": 2 * 3600,
+	"EET":  2 * 3600,
+	"EEST": 3 * 3600,
+	"BST":  1 * 3600,
+}
+
+// Localized month names (Polish, German, French, Spanish) and English full
+// names, mapped to the short English names time.Parse understands.
+var monthNames = map[string]string{
+	"january": "Jan", "february": "Feb", "march": "Mar", "april": "Apr", "june": "Jun", "july": "Jul",
+	"august": "Aug", "september": "Sep", "sept": "Sep", "october": "Oct", "november": "Nov", "december": "Dec",
+
+	"styczeń": "Jan", "stycznia": "Jan", "sty": "Jan",
+	"luty": "Feb", "lutego": "Feb", "lut": "Feb",
+	"marzec": "Mar", "marca": "Mar",
+	"kwiecień": "Apr", "kwietnia": "Apr", "kwi": "Apr",
+	"maj": "May", "maja": "May",
+	"czerwiec": "Jun", "czerwca": "Jun", "cze": "Jun",
+	"lipiec": "Jul", "lipca": "Jul", "lip": "Jul",
+	"sierpień": "Aug", "sierpnia": "Aug", "sie": "Aug",
+	"wrzesień": "Sep", "września": "Sep", "wrz": "Sep",
+	"październik": "Oct", "października": "Oct", "paź": "Oct",
+	"listopad": "Nov", "listopada": "Nov", "lis": "Nov",
+	"grudzień": "Dec", "grudnia": "Dec", "gru": "Dec",
+
+	"januar": "Jan", "jänner": "Jan", "februar": "Feb", "märz": "Mar", "mär": "Mar",
+	"mai": "May", "juni": "Jun", "juli": "Jul", "oktober": "Oct", "okt": "Oct", "dezember": "Dec", "dez": "Dec",
+
+	"janvier": "Jan", "janv": "Jan", "février": "Feb", "févr": "Feb", "mars": "Mar", "avril": "Apr", "avr": "Apr",
+	"juin": "Jun", "juillet": "Jul", "juil": "Jul", "août": "Aug", "septembre": "Sep", "octobre": "Oct",
+	"novembre": "Nov", "décembre": "Dec", "déc": "Dec",
+
+	"enero": "Jan", "ene": "Jan", "febrero": "Feb", "marzo": "Mar", "abril": "Apr", "abr": "Apr", "mayo": "May",
+	"junio": "Jun", "julio": "Jul", "agosto": "Aug", "ago": "Aug", "septiembre": "Sep", "setiembre": "Sep",
+	"octubre": "Oct", "noviembre": "Nov", "diciembre": "Dec", "dic": "Dec",
+}
+
+var (
+	weekdayPrefix = regexp.MustCompile(`^\p{L}+\.?,?\s+`)
+	zoneComment   = regexp.MustCompile(`\s*\([^()]*\)$`)
+	universalZone = regexp.MustCompile(`\s(UT|Z)$`)
+	dateWord      = regexp.MustCompile(`\p{L}+\.?`)
+)
+
+// ParseDate tries DateLayouts in order and returns the time in UTC together
+// with the layout that matched.
+func ParseDate(value string) (time.Time, string, error) {
+	normalized := normalizeDate(value)
+	for _, layout := range DateLayouts {
+		parsed, err := time.Parse(layout, normalized)
+		if err != nil {
+			continue
+		}
+		if name, offset := parsed.Zone(); offset == 0 {
+			if known, ok := zoneOffsets[name]; ok {
+				parsed = time.Date(parsed.Year(), parsed.Month(), parsed.Day(), parsed.Hour(), parsed.Minute(),
+					parsed.Second(), parsed.Nanosecond(), time.FixedZone(name, known))
+			}
+		}
+		return parsed.UTC(), layout, nil
+	}
+	return time.Time{}, "", fmt.Errorf("unrecognized date format: %q", value)
+}
+
+// ResolveDate parses value and falls back to fetchedAt when no layout
+// matches; estimated reports that the fallback was used.
+func ResolveDate(value string, fetchedAt time.Time) (date time.Time, estimated bool) {
+	date, _, err := ParseDate(value)
+	if err != nil {
+		return fetchedAt.UTC(), true
+	}
+	return date, false
+}
+
+// normalizeDate removes the weekday and a trailing zone comment, as in
+// "Tue, 10 Jun 2025 08:00:00 +0000 (UTC)", replaces the RFC 822 zones UT
+// and Z by +0000 and translates month names. A leading word is a weekday,
+// even when it is also a month name, if a comma or a month name follows it,
+// as in the Spanish "Mar, 10 Jun 2025" (martes) or the French
+// "mar. 10 juin 2025"; otherwise it is kept, as in "June 5 2025".
+func normalizeDate(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	value = zoneComment.ReplaceAllString(value, "")
+	value = universalZone.ReplaceAllString(value, " +0000")
+	if prefix := weekdayPrefix.FindString(value); prefix != "" {
+		word := strings.ToLower(strings.TrimRight(prefix, "., \t"))
+		_, isMonth := monthNames[word]
+		rest := value[len(prefix):]
+		if strings.Contains(prefix, ",") || (!isMonth && !isShortMonth(word)) || hasMonth(rest) {
+			value = rest
+		}
+	}
+	value = strings.ReplaceAll(value, ",", "")
+
+	return dateWord.ReplaceAllStringFunc(value, func(word string) string {
+		if month, ok := monthNames[strings.ToLower(strings.TrimSuffix(word, "."))]; ok {
+			return month
+		}
+		return word
+	})
+}
+
+// hasMonth reports whether value contains a month name.
+func hasMonth(value string) bool {
+	for _, word := range dateWord.FindAllString(value, -1) {
+		word = strings.ToLower(strings.TrimSuffix(word, "."))
+		if _, ok := monthNames[word]; ok || isShortMonth(word) {
+			return true
+		}
+	}
+	return false
+}
+
+func isShortMonth(word string) bool {
+	for month := time.January; month <= time.December; month++ {
+		if strings.EqualFold(word, month.String()[:3]) {
+			return true
+		}
+	}
+	return false
+}
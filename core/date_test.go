@@ -0,0 +1,86 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	utc := func(hour, minute int) time.Time { return time.Date(2025, 6, 10, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		value  string
+		want   time.Time
+		layout string
+	}{
+		{"Tue, 10 Jun 2025 08:00:00 +0200", utc(6, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"Tue, 10 Jun 2025 08:00:00 GMT", utc(8, 0), "2 Jan 2006 15:04:05 MST"},
+		{"Tue, 10 Jun 2025 08:00:00 EDT", utc(12, 0), "2 Jan 2006 15:04:05 MST"},
+		{"Tue, 10 Jun 2025 08:00:00 UT", utc(8, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"Tue, 10 Jun 2025 08:00:00 Z", utc(8, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"Tue, 10 Jun 2025 08:00:00 -0400 (EDT)", utc(12, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"Tue, 10 Jun 2025 08:00:00 +0000 (UTC)", utc(8, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"Tuesday, 10 June 2025 08:00 +0200", utc(6, 0), "2 Jan 2006 15:04 -0700"},
+		{"Tue, 10 Jun 2025 08:00 CEST", utc(6, 0), "2 Jan 2006 15:04 MST"},
+		{"Tue, 10 Jun 25 08:00:00 +0000", utc(8, 0), "2 Jan 06 15:04:05 -0700"},
+		{"Tue, 10 Jun 25 08:00:00 PST", utc(16, 0), "2 Jan 06 15:04:05 MST"},
+		{"10 Jun 25 08:00 +0000", utc(8, 0), "2 Jan 06 15:04 -0700"},
+		{"10 Jun 25 08:00 BST", utc(7, 0), "2 Jan 06 15:04 MST"},
+		{"10 Jun 2025 08:00:00", utc(8, 0), "2 Jan 2006 15:04:05"},
+		{"10 June 2025 10:00", utc(10, 0), "2 Jan 2006 15:04"},
+		{"10 June 2025", utc(0, 0), "2 Jan 2006"},
+		{"June 10, 2025 08:00:00 +0000", utc(8, 0), "Jan 2 2006 15:04:05 -0700"},
+		{"June 10 2025 08:00:00 EST", utc(13, 0), "Jan 2 2006 15:04:05 MST"},
+		{"Jun 10 2025 08:00", utc(8, 0), "Jan 2 2006 15:04"},
+		{"June 10 2025", utc(0, 0), "Jan 2 2006"},
+		{"June 10, 2025", utc(0, 0), "Jan 2 2006"},
+		{"2025-06-10T08:00:00+02:00", utc(6, 0), time.RFC3339Nano},
+		{"2025-06-10T08:00:00.123Z", utc(8, 0).Add(123 * time.Millisecond), time.RFC3339Nano},
+		{"2025-06-10T08:00+02:00", utc(6, 0), "2006-01-02T15:04Z07:00"},
+		{"2025-06-10T08:00:00+0200", utc(6, 0), "2006-01-02T15:04:05.999999999-0700"},
+		{"2025-06-10T08:00:00.5-0100", utc(9, 0).Add(500 * time.Millisecond), "2006-01-02T15:04:05.999999999-0700"},
+		{"2025-06-10T08:00+0200", utc(6, 0), "2006-01-02T15:04-0700"},
+		{"2025-06-10T08:00:00", utc(8, 0), "2006-01-02T15:04:05"},
+		{"2025-06-10T08:00", utc(8, 0), "2006-01-02T15:04"},
+		{"2025-06-10 08:00:00 +0200", utc(6, 0), "2006-01-02 15:04:05 -0700"},
+		{"2025-06-10 08:00:00", utc(8, 0), "2006-01-02 15:04:05"},
+		{"2025-06-10 08:00", utc(8, 0), "2006-01-02 15:04"},
+		{"2025-06-10", utc(0, 0), "2006-01-02"},
+		// Localized month and weekday names.
+		{"wt., 10 cze 2025 08:00:00 +0200", utc(6, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"10 czerwca 2025 08:00", utc(8, 0), "2 Jan 2006 15:04"},
+		{"Di, 10 Juni 2025 08:00:00 +0200", utc(6, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"mar. 10 juin 2025 08:00:00 +0200", utc(6, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"Mar, 10 Jun 2025 08:00:00 +0200", utc(6, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"Mar 10 Jun 2025 08:00:00 +0200", utc(6, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"Mar 10 2025 08:00:00 MST", time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC), "Jan 2 2006 15:04:05 MST"},
+		{"May 10, 2025", time.Date(2025, 5, 10, 0, 0, 0, 0, time.UTC), "Jan 2 2006"},
+		{"martes, 10 junio 2025 08:00:00 +0200", utc(6, 0), "2 Jan 2006 15:04:05 -0700"},
+		{"  Tue,  10 Jun 2025\t08:00:00 +0000 ", utc(8, 0), "2 Jan 2006 15:04:05 -0700"},
+	}
+	for _, test := range tests {
+		got, layout, err := ParseDate(test.value)
+		if err != nil {
+			t.Errorf("ParseDate(%q) = %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) || got.Location() != time.UTC || layout != test.layout {
+			t.Errorf("ParseDate(%q) = %v, %q, want %v, %q", test.value, got, layout, test.want, test.layout)
+		}
+	}
+}
+
+func TestParseDateInvalid(t *testing.T) {
+	for _, value := range []string{"", "yesterday", "Tue, 32 Jun 2025 08:00:00 +0000", "10/06/2025", "Mar 2025"} {
+		if date, layout, err := ParseDate(value); err == nil {
+			t.Errorf("ParseDate(%q) = %v, %q, want an error", value, date, layout)
+		}
+	}
+
+	fetchedAt := time.Date(2025, 6, 10, 10, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	if date, estimated := ResolveDate("yesterday", fetchedAt); !estimated || !date.Equal(fetchedAt) || date.Location() != time.UTC {
+		t.Errorf("ResolveDate fallback = %v, %v", date, estimated)
+	}
+	if _, estimated := ResolveDate("2025-06-10", fetchedAt); estimated {
+		t.Error("ResolveDate of a valid date is estimated")
+	}
+}
@@ -0,0 +1,536 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DedupTable is the default table of the DuplicateIndex.
+const DedupTable = "dedup"
+
+const (
+	// TitleDistance is the largest number of differing bits between the
+	// title SimHashes of duplicates; SimHash bands are sized so that such
+	// titles always share one.
+	TitleDistance = 3
+	// ContentDistance is the largest number of differing bits between the
+	// text SimHashes of duplicates, when both texts have at least
+	// minContentWords words; shorter texts are not compared.
+	ContentDistance = 12
+	minContentWords = 20
+	// Titles of fewer words, such as "Live updates", are too common to
+	// tell stories apart: such items are only matched by url.
+	minTitleWords = 3
+	// DedupWindow is the largest time between duplicates with different
+	// urls, so that recurring titles such as "Weather for today" are not
+	// taken for one another.
+	DedupWindow = 72 * time.Hour
+)
+
+// trackingParams are query parameters removed by NormalizeURL besides
+// utm_*.
+var trackingParams = []string{"fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "_ga", "igshid", "yclid"}
+
+// NormalizeURL returns rawURL in a form shared by the links of one story
+// in different feeds: scheme and host in lower case, default port, fragment,
+// utm_* and other tracking parameters removed, remaining parameters sorted.
+func NormalizeURL(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Host == "" {
+		return strings.TrimSpace(rawURL)
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	if port := parsed.Port(); (port == "80" && parsed.Scheme == "http") || (port == "443" && parsed.Scheme == "https") {
+		parsed.Host = parsed.Hostname()
+	}
+	parsed.Fragment, parsed.RawFragment = "", ""
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+
+	query := parsed.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || slices.Contains(trackingParams, lower) {
+			query.Del(key)
+		}
+	}
+	// Encode sorts by key.
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// SimHash returns the 64-bit SimHash of features: texts sharing most
+// features get hashes differing in few bits.
+func SimHash(features []string) uint64 {
+	var weights [64]int
+	for _, feature := range features {
+		hash := fnv.New64a()
+		hash.Write([]byte(feature))
+		sum := hash.Sum64()
+		for bit := range 64 {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var simhash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			simhash |= 1 << bit
+		}
+	}
+	return simhash
+}
+
+// normalizeText returns the words of text in lower case, without
+// punctuation.
+func normalizeText(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// titleFeatures are the character trigrams of a title, which tolerate
+// small changes of short texts better than words.
+func titleFeatures(title string) []string {
+	runes := []rune(strings.Join(normalizeText(title), " "))
+	if len(runes) < 3 {
+		return []string{string(runes)}
+	}
+	features := make([]string, 0, len(runes)-2)
+	for i := range len(runes) - 2 {
+		features = append(features, string(runes[i:i+3]))
+	}
+	return features
+}
+
+// contentFeatures are the word pairs of a text.
+func contentFeatures(words []string) []string {
+	if len(words) < 2 {
+		return words
+	}
+	features := make([]string, 0, len(words)-1)
+	for i := range len(words) - 1 {
+		features = append(features, words[i]+" "+words[i+1])
+	}
+	return features
+}
+
+// Fingerprint identifies an item for duplicate detection. Key names the
+// item in its store and Source the feed it came from; Canonical, set for
+// duplicates, is the Key of the item they were linked to instead of being
+// stored.
+type Fingerprint struct {
+	Target       string    `json:"target"`
+	Key          string    `json:"key"`
+	Source       string    `json:"source"`
+	URL          string    `json:"url"`
+	Title        uint64    `json:"title"`
+	Content      uint64    `json:"content"`
+	Words        int       `json:"words"`
+	Date         time.Time `json:"date"`
+	Canonical    string    `json:"canonical,omitempty"`
+	CanonicalURL string    `json:"canonicalUrl,omitempty"`
+}
+
+// FingerprintOf returns the fingerprint of item in target. Title is 0 for
+// titles of less than minTitleWords words.
+func FingerprintOf(target string, item News) Fingerprint {
+	partitionKey, rowKey := NewsKeys(item)
+	words := normalizeText(item.DescriptionText)
+	fp := Fingerprint{
+		Target:  target,
+		Key:     partitionKey + "/" + rowKey,
+		Source:  item.Source,
+		Content: SimHash(contentFeatures(words)),
+		Words:   len(words),
+		Date:    item.Date.UTC(),
+	}
+	if item.Link != "" {
+		fp.URL = NormalizeURL(item.Link)
+	}
+	if len(normalizeText(item.Title)) >= minTitleWords {
+		fp.Title = SimHash(titleFeatures(item.Title))
+	}
+	return fp
+}
+
+// Duplicates reports whether fp and other are the same story: same
+// normalized url, or close titles and texts within DedupWindow.
+func (fp Fingerprint) Duplicates(other Fingerprint) bool {
+	if fp.URL != "" && fp.URL == other.URL {
+		return true
+	}
+	if fp.Title == 0 || other.Title == 0 || fp.Date.Sub(other.Date).Abs() > DedupWindow {
+		return false
+	}
+	if bits.OnesCount64(fp.Title^other.Title) > TitleDistance {
+		return false
+	}
+	if fp.Words < minContentWords || other.Words < minContentWords {
+		return true
+	}
+	return bits.OnesCount64(fp.Content^other.Content) <= ContentDistance
+}
+
+// canonical returns the key and url of the item fp stands for: itself, or
+// its canonical item when fp is a duplicate.
+func (fp Fingerprint) canonical() (string, string) {
+	if fp.Canonical != "" {
+		return fp.Canonical, fp.CanonicalURL
+	}
+	return fp.Key, fp.URL
+}
+
+// Match returns the first of candidates of the target of fp, from another
+// feed, that fp duplicates: items of one feed are never duplicates of each
+// other. A candidate with the key of fp is fp seen before: it matches,
+// before any other, only when it was linked. Links to fp itself are
+// ignored.
+func (fp Fingerprint) Match(candidates []Fingerprint) (Fingerprint, bool) {
+	for _, candidate := range candidates {
+		if candidate.Target == fp.Target && candidate.Key == fp.Key && candidate.Canonical != "" {
+			return candidate, true
+		}
+	}
+	for _, candidate := range candidates {
+		if candidate.Target != fp.Target || candidate.Source == fp.Source || candidate.Key == fp.Key || candidate.Canonical == fp.Key {
+			continue
+		}
+		if fp.Duplicates(candidate) {
+			return candidate, true
+		}
+	}
+	return Fingerprint{}, false
+}
+
+// fingerprintKeys returns the index partitions of fp: one for its url and
+// one per 16-bit band of its title SimHash. Two titles differing in at
+// most TitleDistance bits share at least one band. Partitions are scoped
+// by a hash of the target, as targets are deduplicated separately.
+func fingerprintKeys(fp Fingerprint) []string {
+	targetSum := sha256.Sum256([]byte(fp.Target))
+	scope := hex.EncodeToString(targetSum[:4])
+	keys := make([]string, 0, 5)
+	if fp.URL != "" {
+		urlSum := sha256.Sum256([]byte(fp.URL))
+		keys = append(keys, scope+"-u-"+hex.EncodeToString(urlSum[:16]))
+	}
+	if fp.Title != 0 {
+		for band := range 4 {
+			keys = append(keys, fmt.Sprintf("%s-t%d-%04x", scope, band, (fp.Title>>(16*band))&0xffff))
+		}
+	}
+	return keys
+}
+
+// fingerprintRowKey is the row of fp in each of its partitions.
+func fingerprintRowKey(fp Fingerprint) string {
+	sum := sha256.Sum256([]byte(fp.Key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// DuplicateIndex keeps the fingerprints of ingested items, so that items
+// of other feeds telling the same story are found. It is read and written
+// once per feed, for all of its items.
+type DuplicateIndex interface {
+	// Candidates returns the indexed fingerprints sharing the url or a
+	// title band with one of fps, in the target of that fingerprint.
+	Candidates(ctx context.Context, fps []Fingerprint) ([]Fingerprint, error)
+	AddFingerprints(ctx context.Context, fps []Fingerprint) error
+}
+
+func OpenDuplicateIndex(config StoreConfig) (DuplicateIndex, error) {
+	switch config.Backend {
+	case "", StoreTable:
+		client, err := OpenTableClient(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewTableDuplicateIndex(client), nil
+	case StoreMemory:
+		return OpenMemoryDuplicateIndex(config.Table), nil
+	case StoreBolt:
+		return OpenBoltDuplicateIndex(config.Path, config.Table)
+	}
+	return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+}
+
+// partitionsOf returns the distinct index partitions of fps, in order.
+func partitionsOf(fps []Fingerprint) []string {
+	var partitions []string
+	seen := map[string]bool{}
+	for _, fp := range fps {
+		for _, partitionKey := range fingerprintKeys(fp) {
+			if !seen[partitionKey] {
+				seen[partitionKey] = true
+				partitions = append(partitions, partitionKey)
+			}
+		}
+	}
+	return partitions
+}
+
+// TableDuplicateIndex keeps fingerprints in Azure Table storage or the
+// Cosmos DB Table API, one entity per partition of fingerprintKeys.
+type TableDuplicateIndex struct {
+	client *aztables.Client
+}
+
+func NewTableDuplicateIndex(client *aztables.Client) *TableDuplicateIndex {
+	return &TableDuplicateIndex{client: client}
+}
+
+// candidateQueries is the largest number of partitions of a
+// TableDuplicateIndex read at a time.
+const candidateQueries = 8
+
+// Candidates reads each partition with its own query, at most
+// candidateQueries at a time: a filter on one PartitionKey reads that
+// partition only, while an "or" of several scans the whole table.
+func (index *TableDuplicateIndex) Candidates(ctx context.Context, fps []Fingerprint) ([]Fingerprint, error) {
+	partitions := partitionsOf(fps)
+	results := make([][]Fingerprint, len(partitions))
+	errs := make([]error, len(partitions))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(candidateQueries, len(partitions)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = index.partition(ctx, partitions[i])
+			}
+		}()
+	}
+	for i := range partitions {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var candidates []Fingerprint
+	seen := map[string]bool{}
+	for _, partition := range results {
+		for _, candidate := range partition {
+			if key := storeKey(candidate.Target, candidate.Key); !seen[key] {
+				seen[key] = true
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// partition returns the fingerprints of one partition.
+func (index *TableDuplicateIndex) partition(ctx context.Context, partitionKey string) ([]Fingerprint, error) {
+	var fps []Fingerprint
+	pager := index.client.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: to.Ptr("PartitionKey eq " + odataString(partitionKey)),
+		Select: to.Ptr("Fingerprint"),
+	})
+	for pager.More() {
+		response, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range response.Entities {
+			var entity aztables.EDMEntity
+			if err := json.Unmarshal(data, &entity); err != nil {
+				return nil, err
+			}
+			var fp Fingerprint
+			if err := json.Unmarshal([]byte(stringProperty(entity.Properties, "Fingerprint")), &fp); err != nil {
+				return nil, err
+			}
+			fps = append(fps, fp)
+		}
+	}
+	return fps, nil
+}
+
+// AddFingerprints upserts fps with one entity group transaction per
+// partition and chunk of up to 100 entities.
+func (index *TableDuplicateIndex) AddFingerprints(ctx context.Context, fps []Fingerprint) error {
+	partitions := map[string][]transactionEntity{}
+	var order []string
+	for _, fp := range fps {
+		value, err := json.Marshal(fp)
+		if err != nil {
+			return err
+		}
+		for _, partitionKey := range fingerprintKeys(fp) {
+			entity := aztables.EDMEntity{
+				Entity: aztables.Entity{
+					PartitionKey: partitionKey,
+					RowKey:       fingerprintRowKey(fp),
+				},
+				Properties: map[string]any{
+					"Fingerprint": string(value),
+				},
+			}
+			data, err := json.Marshal(entity)
+			if err != nil {
+				return err
+			}
+			if _, ok := partitions[partitionKey]; !ok {
+				order = append(order, partitionKey)
+			}
+			partitions[partitionKey] = appendEntity(partitions[partitionKey], transactionEntity{RowKey: entity.RowKey, Data: data})
+		}
+	}
+
+	for _, partitionKey := range order {
+		for _, chunk := range chunkEntities(partitions[partitionKey]) {
+			actions := make([]aztables.TransactionAction, 0, len(chunk))
+			for _, entity := range chunk {
+				actions = append(actions, aztables.TransactionAction{
+					ActionType: aztables.TransactionTypeInsertReplace,
+					Entity:     entity.Data,
+				})
+			}
+			if _, err := index.client.SubmitTransaction(ctx, actions, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	memoryDuplicateIndexes   = map[string]*MemoryDuplicateIndex{}
+	memoryDuplicateIndexesMu sync.Mutex
+)
+
+// MemoryDuplicateIndex keeps fingerprints in process memory.
+type MemoryDuplicateIndex struct {
+	mu         sync.RWMutex
+	partitions map[string]map[string]Fingerprint
+}
+
+// OpenMemoryDuplicateIndex returns the process-wide index of table,
+// creating it on first use.
+func OpenMemoryDuplicateIndex(table string) *MemoryDuplicateIndex {
+	memoryDuplicateIndexesMu.Lock()
+	defer memoryDuplicateIndexesMu.Unlock()
+
+	index, ok := memoryDuplicateIndexes[table]
+	if !ok {
+		index = &MemoryDuplicateIndex{partitions: map[string]map[string]Fingerprint{}}
+		memoryDuplicateIndexes[table] = index
+	}
+	return index
+}
+
+func (index *MemoryDuplicateIndex) Candidates(ctx context.Context, fps []Fingerprint) ([]Fingerprint, error) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	var candidates []Fingerprint
+	seen := map[string]bool{}
+	for _, partitionKey := range partitionsOf(fps) {
+		for rowKey, candidate := range index.partitions[partitionKey] {
+			if !seen[rowKey] {
+				seen[rowKey] = true
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	return candidates, nil
+}
+
+func (index *MemoryDuplicateIndex) AddFingerprints(ctx context.Context, fps []Fingerprint) error {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	for _, fp := range fps {
+		for _, partitionKey := range fingerprintKeys(fp) {
+			partition, ok := index.partitions[partitionKey]
+			if !ok {
+				partition = map[string]Fingerprint{}
+				index.partitions[partitionKey] = partition
+			}
+			partition[fingerprintRowKey(fp)] = fp
+		}
+	}
+	return nil
+}
+
+// BoltDuplicateIndex keeps fingerprints as JSON in a bucket of a BoltDB
+// file, keyed by partition and row.
+type BoltDuplicateIndex struct {
+	store *BoltStore
+}
+
+func OpenBoltDuplicateIndex(path string, table string) (*BoltDuplicateIndex, error) {
+	store, err := OpenBoltStore(path, table)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltDuplicateIndex{store: store}, nil
+}
+
+func (index *BoltDuplicateIndex) Candidates(ctx context.Context, fps []Fingerprint) ([]Fingerprint, error) {
+	var candidates []Fingerprint
+	seen := map[string]bool{}
+	err := index.store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(index.store.bucket).Cursor()
+		for _, partitionKey := range partitionsOf(fps) {
+			prefix := []byte(storeKey(partitionKey, ""))
+			for key, data := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, data = cursor.Next() {
+				_, rowKey := splitStoreKey(string(key))
+				if seen[rowKey] {
+					continue
+				}
+				seen[rowKey] = true
+				var candidate Fingerprint
+				if err := json.Unmarshal(data, &candidate); err != nil {
+					return err
+				}
+				candidates = append(candidates, candidate)
+			}
+		}
+		return nil
+	})
+	return candidates, err
+}
+
+func (index *BoltDuplicateIndex) AddFingerprints(ctx context.Context, fps []Fingerprint) error {
+	return index.store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(index.store.bucket)
+		for _, fp := range fps {
+			data, err := json.Marshal(fp)
+			if err != nil {
+				return err
+			}
+			for _, partitionKey := range fingerprintKeys(fp) {
+				if err := bucket.Put([]byte(storeKey(partitionKey, fingerprintRowKey(fp))), data); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
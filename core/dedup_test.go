@@ -0,0 +1,169 @@
+package core
+
+import (
+	"math/bits"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://news.example.com/a/story", "https://news.example.com/a/story"},
+		{"HTTPS://News.Example.COM/a/Story", "https://news.example.com/a/Story"},
+		{"https://news.example.com:443/a", "https://news.example.com/a"},
+		{"http://news.example.com:80/a", "http://news.example.com/a"},
+		{"http://news.example.com:443/a", "http://news.example.com:443/a"},
+		{"https://news.example.com:8443/a", "https://news.example.com:8443/a"},
+		{"https://news.example.com", "https://news.example.com/"},
+		{"https://news.example.com/a#comments", "https://news.example.com/a"},
+		{"https://news.example.com/a?utm_source=rss&utm_medium=feed&UTM_Campaign=x", "https://news.example.com/a"},
+		{"https://news.example.com/a?fbclid=1&gclid=2&msclkid=3&_ga=4", "https://news.example.com/a"},
+		{"https://news.example.com/a?id=7&utm_source=rss&page=2", "https://news.example.com/a?id=7&page=2"},
+		{"https://news.example.com/a?b=2&a=1", "https://news.example.com/a?a=1&b=2"},
+		{"  https://news.example.com/a  ", "https://news.example.com/a"},
+		{"/a/story", "/a/story"},
+		{"tag:news.example.com,2025:1", "tag:news.example.com,2025:1"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := NormalizeURL(test.url); got != test.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+var dedupDate = time.Date(2025, 6, 10, 8, 0, 0, 0, time.UTC)
+
+// testText returns a text of n words, differing for each seed.
+func testText(seed string, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = seed + strings.Repeat("x", i%7) + string(rune('a'+i%26))
+	}
+	return strings.Join(words, " ")
+}
+
+func testFingerprint(source, link, title, text string, date time.Time) Fingerprint {
+	return FingerprintOf("news", News{Source: source, Link: link, Title: title, DescriptionText: text, Date: date})
+}
+
+func TestFingerprintDuplicates(t *testing.T) {
+	const title = "Central Bank raises interest rates"
+	long := testText("rate", 40)
+	tests := []struct {
+		name  string
+		a, b  Fingerprint
+		match bool
+	}{
+		{"same url",
+			testFingerprint("a", "https://news.example.com/1?utm_source=a", "One title here", "", dedupDate),
+			testFingerprint("b", "https://news.example.com/1#top", "Another title entirely", "", dedupDate.Add(30*24*time.Hour)),
+			true},
+		{"same title, short texts",
+			testFingerprint("a", "https://a.example.com/1", title, "", dedupDate),
+			testFingerprint("b", "https://b.example.com/2", "Central bank raises interest rates!", "Short.", dedupDate.Add(time.Hour)),
+			true},
+		{"same title and text",
+			testFingerprint("a", "https://a.example.com/1", title, long, dedupDate),
+			testFingerprint("b", "https://b.example.com/2", title, long, dedupDate.Add(-DedupWindow)),
+			true},
+		{"same title, different texts",
+			testFingerprint("a", "https://a.example.com/1", title, long, dedupDate),
+			testFingerprint("b", "https://b.example.com/2", title, testText("other", 40), dedupDate),
+			false},
+		{"same title outside the window",
+			testFingerprint("a", "https://a.example.com/1", title, "", dedupDate),
+			testFingerprint("b", "https://b.example.com/2", title, "", dedupDate.Add(DedupWindow+time.Minute)),
+			false},
+		{"different titles",
+			testFingerprint("a", "https://a.example.com/1", title, "", dedupDate),
+			testFingerprint("b", "https://b.example.com/2", "Local team wins the cup final", "", dedupDate),
+			false},
+		{"short titles",
+			testFingerprint("a", "https://a.example.com/1", "Live updates", "", dedupDate),
+			testFingerprint("b", "https://b.example.com/2", "Live updates", "", dedupDate),
+			false},
+		{"no urls",
+			testFingerprint("a", "", "Local team wins", "", dedupDate),
+			testFingerprint("b", "", "Weather for today", "", dedupDate),
+			false},
+	}
+	for _, test := range tests {
+		if got := test.a.Duplicates(test.b); got != test.match {
+			t.Errorf("%s: Duplicates = %v, want %v", test.name, got, test.match)
+		}
+		if got := test.b.Duplicates(test.a); got != test.match {
+			t.Errorf("%s: reversed Duplicates = %v, want %v", test.name, got, test.match)
+		}
+	}
+}
+
+func TestFingerprintTitleBands(t *testing.T) {
+	fp := testFingerprint("a", "", "Central Bank raises interest rates", "", dedupDate)
+	for _, flips := range []uint64{0, 1, 1<<15 | 1<<31, 1<<3 | 1<<20 | 1<<40} {
+		other := fp
+		other.Title ^= flips
+		if bits.OnesCount64(flips) > TitleDistance {
+			t.Fatalf("flips %x exceed TitleDistance", flips)
+		}
+		if !sharesPartition(fingerprintKeys(fp), fingerprintKeys(other)) {
+			t.Errorf("titles differing in bits %x share no partition", flips)
+		}
+	}
+}
+
+func sharesPartition(a, b []string) bool {
+	for _, key := range a {
+		for _, other := range b {
+			if key == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestFingerprintMatch(t *testing.T) {
+	const title = "Central Bank raises interest rates"
+	fp := testFingerprint("feed-a", "https://a.example.com/1", title, "", dedupDate)
+	otherFeed := testFingerprint("feed-b", "https://b.example.com/1", title, "", dedupDate)
+	thirdFeed := testFingerprint("feed-c", "https://c.example.com/1", title, "", dedupDate)
+	sameFeed := testFingerprint("feed-a", "https://a.example.com/2", title, "", dedupDate)
+	otherTarget := otherFeed
+	otherTarget.Target = "archive"
+	unrelated := testFingerprint("feed-b", "https://b.example.com/2", "Local team wins the cup final", "", dedupDate)
+	seenBefore := fp
+	linkedBefore := fp
+	linkedBefore.Canonical, linkedBefore.CanonicalURL = thirdFeed.Key, thirdFeed.URL
+	linkedToFp := otherFeed
+	linkedToFp.Canonical, linkedToFp.CanonicalURL = fp.Key, fp.URL
+
+	tests := []struct {
+		name       string
+		candidates []Fingerprint
+		want       string
+	}{
+		{"no candidates", nil, ""},
+		{"another feed", []Fingerprint{unrelated, otherFeed}, otherFeed.Key},
+		{"first match", []Fingerprint{thirdFeed, otherFeed}, thirdFeed.Key},
+		{"same feed", []Fingerprint{sameFeed}, ""},
+		{"another target", []Fingerprint{otherTarget}, ""},
+		{"seen before", []Fingerprint{seenBefore}, ""},
+		{"seen before and another feed", []Fingerprint{seenBefore, otherFeed}, otherFeed.Key},
+		{"linked before", []Fingerprint{otherFeed, linkedBefore}, fp.Key},
+		{"linked to fp", []Fingerprint{linkedToFp}, ""},
+	}
+	for _, test := range tests {
+		match, ok := fp.Match(test.candidates)
+		if ok != (test.want != "") || match.Key != test.want {
+			t.Errorf("%s: Match = %q, %v, want %q", test.name, match.Key, ok, test.want)
+		}
+	}
+	if match, _ := fp.Match([]Fingerprint{otherFeed, linkedBefore}); match.Canonical != thirdFeed.Key {
+		t.Errorf("Match of an item linked before = %+v, want its canonical %s", match, thirdFeed.Key)
+	}
+}
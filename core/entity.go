@@ -0,0 +1,115 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+)
+
+// NewsSchemaVersion is written to every stored entity as SchemaVersion.
+//
+//	1: Title, Description, Date, DateEstimated (rows without SchemaVersion)
+//	2: adds Id, Link, Source, Channel, Author, Categories (JSON array) and
+//	   Enclosure (URL)
+//	3: replaces Enclosure with Media (JSON array of Media)
+//	4: Description is sanitized HTML; adds DescriptionText, WordCount and
+//	   Image
+const NewsSchemaVersion = 4
+
+func newsEntity(item News) ([]byte, error) {
+	partitionKey, rowKey := NewsKeys(item)
+	categories, err := json.Marshal(item.Categories)
+	if err != nil {
+		return nil, err
+	}
+	media, err := json.Marshal(item.Media)
+	if err != nil {
+		return nil, err
+	}
+
+	entity := aztables.EDMEntity{
+		Entity: aztables.Entity{
+			RowKey:       rowKey,
+			PartitionKey: partitionKey,
+		},
+		Properties: map[string]any{
+			"SchemaVersion":   NewsSchemaVersion,
+			"Id":              item.Id,
+			"Link":            item.Link,
+			"Source":          item.Source,
+			"Channel":         item.Channel,
+			"Title":           item.Title,
+			"Description":     item.Description,
+			"DescriptionText": item.DescriptionText,
+			"WordCount":       int32(item.WordCount),
+			"Image":           item.Image,
+			"Date":            aztables.EDMDateTime(item.Date),
+			"DateEstimated":   item.DateEstimated,
+			"Author":          item.Author,
+			"Categories":      string(categories),
+			"Media":           string(media),
+		},
+	}
+	return json.Marshal(entity)
+}
+
+// NewsFromEntity decodes a stored entity of any schema version. Properties
+// missing from older versions are left empty.
+func NewsFromEntity(data []byte) (News, error) {
+	entity := aztables.EDMEntity{}
+	if err := json.Unmarshal(data, &entity); err != nil {
+		return News{}, err
+	}
+	props := entity.Properties
+
+	item := News{
+		Title:       stringProperty(props, "Title"),
+		Description: stringProperty(props, "Description"),
+	}
+	if date, ok := props["Date"].(aztables.EDMDateTime); ok {
+		item.Date = time.Time(date)
+	}
+	item.DateEstimated, _ = props["DateEstimated"].(bool)
+
+	version, _ := props["SchemaVersion"].(int32)
+	if version < 2 {
+		return withContent(item), nil
+	}
+	item.Id = stringProperty(props, "Id")
+	item.Link = stringProperty(props, "Link")
+	item.Source = stringProperty(props, "Source")
+	item.Channel = stringProperty(props, "Channel")
+	item.Author = stringProperty(props, "Author")
+	if categories := stringProperty(props, "Categories"); categories != "" {
+		if err := json.Unmarshal([]byte(categories), &item.Categories); err != nil {
+			return News{}, err
+		}
+	}
+
+	if version < 3 {
+		if enclosure := stringProperty(props, "Enclosure"); enclosure != "" {
+			item.Media = []Media{{Rel: MediaRelEnclosure, URL: enclosure}}
+		}
+		return withContent(item), nil
+	}
+	if media := stringProperty(props, "Media"); media != "" {
+		if err := json.Unmarshal([]byte(media), &item.Media); err != nil {
+			return News{}, err
+		}
+	}
+
+	if version < 4 {
+		return withContent(item), nil
+	}
+	item.DescriptionText = stringProperty(props, "DescriptionText")
+	wordCount, _ := props["WordCount"].(int32)
+	item.WordCount = int(wordCount)
+	item.Image = stringProperty(props, "Image")
+	return item, nil
+}
+
+func stringProperty(props map[string]any, name string) string {
+	value, _ := props[name].(string)
+	return value
+}
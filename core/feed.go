@@ -0,0 +1,315 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"mime"
+	"strings"
+	"time"
+)
+
+const (
+	FormatRSS      = "rss"
+	FormatAtom     = "atom"
+	FormatJSONFeed = "jsonfeed"
+	FormatRDF      = "rdf"
+)
+
+// DetectFormat picks the feed format from the response Content-Type when it
+// is a JSON type, otherwise by sniffing the body: a leading '{' means JSON
+// Feed, anything else is an XML document identified by its root element.
+func DetectFormat(contentType string, data []byte) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/feed+json" || mediaType == "application/json" {
+		return FormatJSONFeed, nil
+	}
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return FormatJSONFeed, nil
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("no root element found: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "rss":
+			return FormatRSS, nil
+		case "feed":
+			return FormatAtom, nil
+		case "RDF":
+			return FormatRDF, nil
+		}
+		return "", fmt.Errorf("unsupported root element <%s>", start.Name.Local)
+	}
+}
+
+// ParseFeed decodes an RSS 2.0, RSS 1.0 (RDF), Atom 1.0 or JSON Feed
+// document into News items; documents in other charsets than UTF-8 are
+// transcoded first, see DecodeCharset. Descriptions are sanitized, see
+// ProcessContent. Items whose date cannot be parsed are dated fetchedAt and
+// marked DateEstimated.
+func ParseFeed(contentType string, data []byte, fetchedAt time.Time) (Feed, error) {
+	data, err := DecodeCharset(contentType, data)
+	if err != nil {
+		return Feed{}, err
+	}
+	format, err := DetectFormat(contentType, data)
+	if err != nil {
+		return Feed{}, err
+	}
+
+	var feed Feed
+	switch format {
+	case FormatJSONFeed:
+		document := JSONFeed{}
+		if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), &document); err != nil {
+			return Feed{}, err
+		}
+		if !strings.HasPrefix(document.Version, "https://jsonfeed.org/version/") {
+			return Feed{}, fmt.Errorf("unsupported JSON Feed version %q", document.Version)
+		}
+		feed = jsonFeedToFeed(document, fetchedAt)
+	case FormatAtom:
+		document := AtomFeed{}
+		if err := xml.Unmarshal(data, &document); err != nil {
+			return Feed{}, err
+		}
+		feed = atomToFeed(document, fetchedAt)
+	case FormatRDF:
+		document := RDFFormat{}
+		if err := xml.Unmarshal(data, &document); err != nil {
+			return Feed{}, err
+		}
+		feed = rdfToFeed(document, fetchedAt)
+	default:
+		document := AtomFormat{}
+		if err := xml.Unmarshal(data, &document); err != nil {
+			return Feed{}, err
+		}
+		feed = rssToFeed(document, fetchedAt)
+	}
+
+	for i := range feed.Items {
+		feed.Items[i] = withContent(feed.Items[i])
+		feed.Items[i].Channel = feed.Title
+	}
+	return feed, nil
+}
+
+func rssToFeed(feed AtomFormat, fetchedAt time.Time) Feed {
+	channel := feed.AtomChannel
+	result := Feed{FeedMetadata: FeedMetadata{
+		Format:        FormatRSS,
+		Title:         channel.Title,
+		Link:          channel.Link,
+		Language:      channel.Language,
+		TTL:           int(channel.TTL),
+		LastBuildDate: optionalDate(channel.LastBuildDate),
+	}}
+	for _, item := range feed.AtomChannel.AtomEntries {
+		date, estimated := ResolveDate(item.Date, fetchedAt)
+		author := item.Author
+		if author == "" {
+			author = item.Creator
+		}
+		result.Items = append(result.Items, News{
+			Id:            item.Id,
+			Link:          item.Link,
+			Title:         item.Title,
+			Date:          date,
+			DateEstimated: estimated,
+			Description:   item.Description.Data,
+			Author:        author,
+			Categories:    item.Category,
+			Media:         rssMedia(item, item.Link),
+		})
+	}
+	return result
+}
+
+func atomToFeed(feed AtomFeed, fetchedAt time.Time) Feed {
+	result := Feed{FeedMetadata: FeedMetadata{
+		Format:        FormatAtom,
+		Title:         feed.Title.String(),
+		Link:          atomHref(feed.Links, "alternate"),
+		Language:      feed.Lang,
+		LastBuildDate: optionalDate(feed.Updated),
+	}}
+	for _, entry := range feed.Entries {
+		raw := entry.Published
+		if raw == "" {
+			raw = entry.Updated
+		}
+		date, estimated := ResolveDate(raw, fetchedAt)
+
+		description := entry.Content.HTML()
+		if description == "" {
+			description = entry.Summary.HTML()
+		}
+		var author string
+		if len(entry.Authors) > 0 {
+			author = entry.Authors[0].Name
+		}
+		var categories []string
+		for _, category := range entry.Categories {
+			categories = append(categories, category.Term)
+		}
+		link := entry.Href("alternate")
+		result.Items = append(result.Items, News{
+			Id:            entry.Id,
+			Link:          link,
+			Title:         entry.Title.String(),
+			Date:          date,
+			DateEstimated: estimated,
+			Description:   description,
+			Author:        author,
+			Categories:    categories,
+			Media:         atomMedia(entry, link),
+		})
+	}
+	return result
+}
+
+func jsonFeedToFeed(feed JSONFeed, fetchedAt time.Time) Feed {
+	result := Feed{FeedMetadata: FeedMetadata{
+		Format:   FormatJSONFeed,
+		Title:    feed.Title,
+		Link:     feed.HomePageURL,
+		Language: feed.Language,
+	}}
+	for _, item := range feed.Items {
+		raw := item.DatePublished
+		if raw == "" {
+			raw = item.DateModified
+		}
+		date, estimated := ResolveDate(raw, fetchedAt)
+
+		description := item.ContentHTML
+		if description == "" {
+			description = html.EscapeString(item.ContentText)
+		}
+		if description == "" {
+			description = html.EscapeString(item.Summary)
+		}
+		var author string
+		if item.Author != nil {
+			author = item.Author.Name
+		} else if len(item.Authors) > 0 {
+			author = item.Authors[0].Name
+		}
+		result.Items = append(result.Items, News{
+			Id:            string(item.Id),
+			Link:          item.URL,
+			Title:         item.Title,
+			Date:          date,
+			DateEstimated: estimated,
+			Description:   description,
+			Author:        author,
+			Categories:    item.Tags,
+			Media:         jsonFeedMedia(item, item.URL),
+		})
+	}
+	return result
+}
+
+func rdfToFeed(feed RDFFormat, fetchedAt time.Time) Feed {
+	result := Feed{FeedMetadata: FeedMetadata{
+		Format:        FormatRDF,
+		Title:         feed.Channel.Title,
+		Link:          feed.Channel.Link,
+		Language:      feed.Channel.Language,
+		LastBuildDate: optionalDate(feed.Channel.Date),
+	}}
+	for _, item := range feed.Items {
+		date, estimated := ResolveDate(item.Date, fetchedAt)
+		result.Items = append(result.Items, News{
+			Id:            item.About,
+			Link:          item.Link,
+			Title:         item.Title,
+			Date:          date,
+			DateEstimated: estimated,
+			Description:   item.Description,
+			Author:        item.Creator,
+			Categories:    item.Subject,
+		})
+	}
+	return result
+}
+
+// String returns an Atom text construct as plain text, for titles: html and
+// xhtml content is reduced to its text on one line, see ProcessContent.
+func (text AtomText) String() string {
+	if text.Type == "html" || text.Type == "xhtml" {
+		return strings.Join(strings.Fields(ProcessContent(text.HTML(), "").Text), " ")
+	}
+	return strings.TrimSpace(text.Data)
+}
+
+// HTML returns an Atom text construct as markup. Only content explicitly
+// typed "text" is escaped: feeds often leave out type="html".
+func (text AtomText) HTML() string {
+	switch text.Type {
+	case "text":
+		return html.EscapeString(strings.TrimSpace(text.Data))
+	case "xhtml":
+		return strings.TrimSpace(text.Inner)
+	}
+	return strings.TrimSpace(text.Data)
+}
+
+// UnmarshalJSON accepts a string or a number; JSON Feed 1.1 requires readers
+// to coerce other ids to strings.
+func (id *JSONFeedID) UnmarshalJSON(data []byte) error {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case string:
+		*id = JSONFeedID(value)
+	case json.Number:
+		*id = JSONFeedID(value.String())
+	case nil:
+		*id = ""
+	default:
+		return fmt.Errorf("item id must be a string or a number, not %s", data)
+	}
+	return nil
+}
+
+// Href returns the entry link with the given relation; "alternate" also
+// matches links without a rel attribute.
+func (entry AtomFeedEntry) Href(rel string) string {
+	return atomHref(entry.Links, rel)
+}
+
+func atomHref(links []AtomLink, rel string) string {
+	for _, link := range links {
+		if link.Rel == rel || (link.Rel == "" && rel == "alternate") {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// optionalDate parses a feed-level date, returning the zero time when it is
+// missing or not recognized.
+func optionalDate(value string) time.Time {
+	date, _, err := ParseDate(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJSONFeedIDs(t *testing.T) {
+	const document = `{"version": "https://jsonfeed.org/version/1", "items": [
+{"id": "tag:example.com,2025:1", "url": "https://example.com/1"},
+{"id": 2, "url": "https://example.com/2"},
+{"id": 12345678901234567890, "url": "https://example.com/3"},
+{"id": 1.5, "url": "https://example.com/4"},
+{"url": "https://example.com/5"}]}`
+	feed, err := ParseFeed("application/feed+json", []byte(document), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"tag:example.com,2025:1", "2", "12345678901234567890", "1.5", ""}
+	for i, item := range feed.Items {
+		if item.Id != want[i] {
+			t.Errorf("item %d Id = %q, want %q", i, item.Id, want[i])
+		}
+	}
+
+	if _, err := ParseFeed("application/feed+json", []byte(`{"version": "https://jsonfeed.org/version/1", "items": [{"id": {}}]}`), time.Now()); err == nil {
+		t.Error("ParseFeed accepted an object id")
+	}
+}
+
+func TestParseAtomTitles(t *testing.T) {
+	const document = `<feed xmlns="http://www.w3.org/2005/Atom"><title type="html">News &amp;amp; &lt;b&gt;Views&lt;/b&gt;</title>
+<entry><title>Plain &amp; simple &lt;b&gt;</title><link href="https://example.com/1"/></entry>
+<entry><title type="text">Typed text</title><link href="https://example.com/2"/></entry>
+<entry><title type="html">A &amp;amp; B &lt;em&gt;now&lt;/em&gt;</title><link href="https://example.com/3"/></entry>
+<entry><title type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml">Rates <b>rise</b>
+  again</div></title><link href="https://example.com/4"/></entry>
+<entry><title type="html">&lt;script&gt;alert(1)&lt;/script&gt;Safe</title><link href="https://example.com/5"/></entry>
+</feed>`
+	feed, err := ParseFeed("application/atom+xml", []byte(document), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "News & Views" {
+		t.Errorf("feed Title = %q", feed.Title)
+	}
+	want := []string{"Plain & simple <b>", "Typed text", "A & B now", "Rates rise again", "Safe"}
+	for i, item := range feed.Items {
+		if item.Title != want[i] {
+			t.Errorf("entry %d Title = %q, want %q", i, item.Title, want[i])
+		}
+	}
+}
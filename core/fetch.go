@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type FetchResult struct {
+	StatusCode   int
+	ContentType  string
+	ETag         string
+	LastModified string
+	// NotModified is set when the server answered a conditional request
+	// with 304; Body is then empty.
+	NotModified bool
+	Body        []byte
+	FetchedAt   time.Time
+}
+
+// HTTPStatusError is returned by FetchFeed when the feed server answers
+// with a status other than 2xx.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (err *HTTPStatusError) Error() string {
+	return "feed responded with " + err.Status
+}
+
+// FetchFeed downloads feedURL. The ETag and LastModified of state, when
+// set, are sent as If-None-Match and If-Modified-Since.
+func FetchFeed(ctx context.Context, client *http.Client, feedURL string, state FeedState) (FetchResult, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	if state.ETag != "" {
+		request.Header.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		request.Header.Set("If-Modified-Since", state.LastModified)
+	}
+	result := FetchResult{FetchedAt: time.Now()}
+	response, err := client.Do(request)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	defer response.Body.Close()
+
+	result.StatusCode = response.StatusCode
+	result.ETag = response.Header.Get("ETag")
+	result.LastModified = response.Header.Get("Last-Modified")
+	if response.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return result, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return result, &HTTPStatusError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+	result.ContentType = response.Header.Get("Content-Type")
+	result.Body, err = io.ReadAll(response.Body)
+	if err != nil {
+		return result, fmt.Errorf("reading feed: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUserAgent       = "azure-feed-ingest/1.0"
+	DefaultFetchAttempts   = 3
+	DefaultRetryBaseDelay  = 500 * time.Millisecond
+	DefaultRetryMaxDelay   = 10 * time.Second
+	DefaultHostConcurrency = 2
+)
+
+// RetryPolicy says how a failed fetch is tried again. Network errors, 5xx,
+// 408 and 429 answers are retried after an exponential delay with jitter, or
+// after the server's Retry-After when it sends one.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt; 1 or less disables retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled after each
+	// one up to MaxDelay. A Retry-After longer than MaxDelay is not waited
+	// for and the answer is returned as is.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy returns DefaultFetchAttempts attempts, waiting from
+// DefaultRetryBaseDelay up to DefaultRetryMaxDelay.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultFetchAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+	}
+}
+
+// delay returns the wait before attempt number attempt+1, a random duration
+// between half and all of the exponential delay.
+func (retry RetryPolicy) delay(attempt int) time.Duration {
+	delay := retry.MaxDelay
+	if shift := attempt - 1; shift < 30 && retry.BaseDelay<<shift < retry.MaxDelay {
+		delay = retry.BaseDelay << shift
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryStatus reports whether an answer with code may be retried.
+func retryStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// retryAfter parses the Retry-After header, in seconds or as a date.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// politeTransport sends the User-Agent, limits the requests in flight to
+// each host and retries failed requests.
+type politeTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	retry     RetryPolicy
+	perHost   int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func (transport *politeTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	// A RoundTripper must not change the caller's request.
+	request = request.Clone(request.Context())
+	if transport.userAgent != "" && request.Header.Get("User-Agent") == "" {
+		request.Header.Set("User-Agent", transport.userAgent)
+	}
+	ctx := request.Context()
+	// Requests with a body cannot be replayed without GetBody.
+	replayable := request.Body == nil || request.Body == http.NoBody || request.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request.Body = body
+		}
+		release, err := transport.acquire(ctx, request.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+		response, err := transport.base.RoundTrip(request)
+		if err != nil {
+			release()
+		} else {
+			response.Body = &releaseBody{ReadCloser: response.Body, release: release}
+		}
+
+		if !replayable || attempt >= transport.retry.MaxAttempts || ctx.Err() != nil {
+			return response, err
+		}
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if refused(err) {
+				return nil, err
+			}
+			wait = transport.retry.delay(attempt)
+		case retryStatus(response.StatusCode):
+			wait = transport.retry.delay(attempt)
+			if after, ok := retryAfter(response.Header.Get("Retry-After"), time.Now()); ok {
+				if after > transport.retry.MaxDelay {
+					return response, nil
+				}
+				wait = after
+			}
+		default:
+			return response, nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return response, err
+		}
+		if response != nil {
+			io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// acquire takes one of the perHost request slots of host, waiting for a
+// slot or the end of ctx. The returned func gives the slot back.
+func (transport *politeTransport) acquire(ctx context.Context, host string) (func(), error) {
+	if transport.perHost <= 0 {
+		return func() {}, nil
+	}
+	transport.mu.Lock()
+	slots, ok := transport.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, transport.perHost)
+		transport.hosts[host] = slots
+	}
+	transport.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-slots }) }, nil
+}
+
+// releaseBody holds a host slot until the response body is closed, as the
+// connection is busy until then.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (body *releaseBody) Close() error {
+	defer body.release()
+	return body.ReadCloser.Close()
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultMaxRedirects = 5
+	DefaultMaxFeedBytes = 10 << 20
+	DefaultDialTimeout  = 10 * time.Second
+)
+
+// FetchPolicy restricts what a feed client may fetch and says how. Feed urls
+// come from callers, so without it the server can be made to read internal
+// services such as the cloud metadata endpoint.
+type FetchPolicy struct {
+	// Schemes allowed in feed urls and redirects; http and https when empty.
+	Schemes []string
+	// AllowPrivate permits loopback, private, link-local and other
+	// non-public addresses, e.g. for local development.
+	AllowPrivate bool
+	// AllowHosts, when not empty, are the only hosts that may be fetched.
+	// An entry also matches its subdomains. DenyHosts are never fetched and
+	// win over AllowHosts.
+	AllowHosts []string
+	DenyHosts  []string
+	// MaxRedirects is the number of redirects followed.
+	MaxRedirects int
+	// MaxBodyBytes caps the size of a feed document.
+	MaxBodyBytes int64
+	// Timeout bounds a whole fetch, redirects and body included;
+	// DialTimeout bounds each connection attempt.
+	Timeout     time.Duration
+	DialTimeout time.Duration
+	// UserAgent is sent with every request. HostConcurrency limits the
+	// requests in flight to one host, none when 0. Retry says how
+	// transient failures are retried.
+	UserAgent       string
+	HostConcurrency int
+	Retry           RetryPolicy
+}
+
+// DefaultFetchPolicy returns the policy of the feed client: public http(s)
+// hosts only, DefaultMaxRedirects redirects, documents of at most
+// DefaultMaxFeedBytes, DefaultHostConcurrency requests per host and the
+// DefaultRetryPolicy.
+func DefaultFetchPolicy() FetchPolicy {
+	return FetchPolicy{
+		Schemes:         []string{"http", "https"},
+		MaxRedirects:    DefaultMaxRedirects,
+		MaxBodyBytes:    DefaultMaxFeedBytes,
+		Timeout:         DefaultFeedTimeout,
+		DialTimeout:     DefaultDialTimeout,
+		UserAgent:       DefaultUserAgent,
+		HostConcurrency: DefaultHostConcurrency,
+		Retry:           DefaultRetryPolicy(),
+	}
+}
+
+// PolicyError is returned when a fetch is refused by the FetchPolicy.
+type PolicyError struct {
+	URL    string
+	Reason string
+}
+
+func (err *PolicyError) Error() string {
+	return fmt.Sprintf("fetching %s is not allowed: %s", err.URL, err.Reason)
+}
+
+// BodyTooLargeError is returned when a feed document exceeds
+// FetchPolicy.MaxBodyBytes.
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+func (err *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("feed is larger than %d bytes", err.Limit)
+}
+
+// CheckURL reports whether feedURL may be fetched, judging by its scheme
+// and host. Addresses of host names are checked later, when connecting.
+func (policy FetchPolicy) CheckURL(feedURL *url.URL) error {
+	refuse := func(format string, args ...any) error {
+		return &PolicyError{URL: feedURL.Redacted(), Reason: fmt.Sprintf(format, args...)}
+	}
+	schemes := policy.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	if !slices.Contains(schemes, strings.ToLower(feedURL.Scheme)) {
+		return refuse("scheme %q", feedURL.Scheme)
+	}
+	host := strings.TrimSuffix(strings.ToLower(feedURL.Hostname()), ".")
+	if host == "" {
+		return refuse("no host")
+	}
+	if matchHost(policy.DenyHosts, host) {
+		return refuse("host %s is denied", host)
+	}
+	if len(policy.AllowHosts) > 0 && !matchHost(policy.AllowHosts, host) {
+		return refuse("host %s is not allowed", host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if err := policy.checkAddr(addr); err != nil {
+			return refuse("%v", err)
+		}
+	}
+	return nil
+}
+
+func matchHost(hosts []string, host string) bool {
+	for _, entry := range hosts {
+		entry = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(entry)), ".")
+		if entry != "" && (host == entry || strings.HasSuffix(host, "."+entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nonPublicPrefixes are ranges not covered by the netip predicates that
+// must not be reachable either.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, may embed private IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/32"),       // Teredo, may embed private IPv4
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, may embed private IPv4
+	netip.MustParsePrefix("fec0::/10"),       // site-local
+}
+
+func (policy FetchPolicy) checkAddr(addr netip.Addr) error {
+	if policy.AllowPrivate {
+		return nil
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return fmt.Errorf("address %s is not public", addr)
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("address %s is not public", addr)
+		}
+	}
+	return nil
+}
+
+// NewFetchClient returns an http.Client that enforces policy on every
+// request and redirect. Addresses are checked after DNS resolution, on the
+// connection actually made, so a host name resolving to an internal
+// address is refused too. Proxies from the environment are not used, as
+// they would hide the address of the feed server. Transient failures are
+// retried within Timeout and the context of the request.
+func NewFetchClient(policy FetchPolicy) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: policy.DialTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return &PolicyError{URL: address, Reason: err.Error()}
+			}
+			if err := policy.checkAddr(addrPort.Addr()); err != nil {
+				return &PolicyError{URL: address, Reason: err.Error()}
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: policy.Timeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: &politeTransport{
+			base:      &policyTransport{policy: policy, base: transport},
+			userAgent: policy.UserAgent,
+			retry:     policy.Retry,
+			perHost:   policy.HostConcurrency,
+			hosts:     map[string]chan struct{}{},
+		},
+		Timeout: policy.Timeout,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) > policy.MaxRedirects {
+				return &PolicyError{URL: request.URL.Redacted(), Reason: fmt.Sprintf("more than %d redirects", policy.MaxRedirects)}
+			}
+			return nil
+		},
+	}
+}
+
+// policyTransport checks the url of each request, redirects included, and
+// caps the size of response bodies.
+type policyTransport struct {
+	policy FetchPolicy
+	base   http.RoundTripper
+}
+
+func (transport *policyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if err := transport.policy.CheckURL(request.URL); err != nil {
+		return nil, err
+	}
+	response, err := transport.base.RoundTrip(request)
+	if err != nil || transport.policy.MaxBodyBytes <= 0 {
+		return response, err
+	}
+	limit := transport.policy.MaxBodyBytes
+	if response.ContentLength > limit {
+		response.Body.Close()
+		return nil, &BodyTooLargeError{Limit: limit}
+	}
+	response.Body = &limitedBody{ReadCloser: response.Body, remaining: limit, limit: limit}
+	return response, nil
+}
+
+// limitedBody fails with BodyTooLargeError once more than limit bytes are
+// read, rather than silently truncating the document.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.remaining < 0 {
+		return 0, &BodyTooLargeError{Limit: body.limit}
+	}
+	if int64(len(p)) > body.remaining+1 {
+		p = p[:body.remaining+1]
+	}
+	n, err := body.ReadCloser.Read(p)
+	body.remaining -= int64(n)
+	if body.remaining < 0 {
+		return n + int(body.remaining), &BodyTooLargeError{Limit: body.limit}
+	}
+	return n, err
+}
+
+// refused reports whether err is a refusal of the fetch policy, which
+// trying again cannot change.
+func refused(err error) bool {
+	var policyErr *PolicyError
+	var sizeErr *BodyTooLargeError
+	return errors.As(err, &policyErr) || errors.As(err, &sizeErr)
+}
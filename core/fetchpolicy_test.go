@@ -0,0 +1,242 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		private bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.0.0.1", true},
+		{"172.16.5.4", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true}, // cloud metadata
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"224.0.0.1", true},
+		{"100.64.0.1", true},       // carrier-grade NAT
+		{"::ffff:127.0.0.1", true}, // IPv4-mapped loopback
+		{"::ffff:10.0.0.1", true},
+		{"64:ff9b::a00:1", true},                       // NAT64 of 10.0.0.1
+		{"2001:0:4136:e378:8000:63bf:f5ff:fffe", true}, // Teredo
+		{"2002:a00:1::1", true},                        // 6to4 of 10.0.0.1
+		{"fec0::1", true},
+		{"93.184.216.34", false},
+		{"8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+		{"::ffff:8.8.8.8", false},
+	}
+	policy := DefaultFetchPolicy()
+	for _, test := range tests {
+		err := policy.checkAddr(netip.MustParseAddr(test.addr))
+		if (err != nil) != test.private {
+			t.Errorf("checkAddr(%s) = %v, want refused %v", test.addr, err, test.private)
+		}
+	}
+
+	policy.AllowPrivate = true
+	for _, test := range tests {
+		if err := policy.checkAddr(netip.MustParseAddr(test.addr)); err != nil {
+			t.Errorf("checkAddr(%s) with AllowPrivate = %v", test.addr, err)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	policy := DefaultFetchPolicy()
+	policy.AllowHosts = []string{"example.com", "feeds.test."}
+	policy.DenyHosts = []string{"bad.example.com"}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/feed", true},
+		{"http://news.example.com/feed", true},
+		{"https://EXAMPLE.com./feed", true},
+		{"https://feeds.test/rss", true},
+		{"https://bad.example.com/feed", false},
+		{"https://very.bad.example.com/feed", false},
+		{"https://notexample.com/feed", false},
+		{"https://example.com.evil.test/feed", false},
+		{"ftp://example.com/feed", false},
+		{"file:///etc/passwd", false},
+		{"javascript:alert(1)", false},
+		{"http:///feed", false},
+	}
+	for _, test := range tests {
+		feedURL, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = policy.CheckURL(feedURL)
+		if (err == nil) != test.allowed {
+			t.Errorf("CheckURL(%s) = %v, want allowed %v", test.url, err, test.allowed)
+		}
+		var policyErr *PolicyError
+		if err != nil && !errors.As(err, &policyErr) {
+			t.Errorf("CheckURL(%s) = %T, want *PolicyError", test.url, err)
+		}
+	}
+
+	// Literal addresses are checked without waiting for a connection.
+	policy = DefaultFetchPolicy()
+	for _, literal := range []string{"http://127.0.0.1/", "http://[::1]/", "http://169.254.169.254/latest/meta-data", "http://[::ffff:10.0.0.1]/"} {
+		feedURL, _ := url.Parse(literal)
+		if err := policy.CheckURL(feedURL); err == nil {
+			t.Errorf("CheckURL(%s) allowed a private address", literal)
+		}
+	}
+}
+
+// testHost is served by the test server without the address check, as
+// a public host would be; every other host is dialed under the policy.
+const testHost = "feed.test"
+
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>T</title></channel></rss>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	})
+	mux.HandleFunc("/hops/{n}", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.PathValue("n"))
+		if n == 0 {
+			http.Redirect(w, r, "/feed", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/hops/"+strconv.Itoa(n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5000")
+		w.Write([]byte(strings.Repeat("x", 5000)))
+	})
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		for range 50 {
+			w.Write([]byte(strings.Repeat("x", 100)))
+			w.(http.Flusher).Flush()
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testClient returns a feed client enforcing policy that reaches server as
+// testHost, without retries.
+func testClient(policy FetchPolicy, server *httptest.Server) *http.Client {
+	policy.Retry = RetryPolicy{MaxAttempts: 1}
+	client := NewFetchClient(policy)
+	transport := client.Transport.(*politeTransport).base.(*policyTransport).base.(*http.Transport)
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, _ := net.SplitHostPort(address); host == testHost {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		}
+		return dial(ctx, network, address)
+	}
+	return client
+}
+
+func testURL(server *httptest.Server, path string) string {
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	return "http://" + testHost + ":" + port + path
+}
+
+func TestFetchClientRefusals(t *testing.T) {
+	server := newTestServer(t)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	policy := DefaultFetchPolicy()
+	policy.DenyHosts = []string{"denied.test"}
+	client := testClient(policy, server)
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		// localhost passes CheckURL as a name and is refused once resolved.
+		{"loopback after DNS", "http://localhost:" + port + "/feed"},
+		{"loopback literal", server.URL + "/feed"},
+		{"redirect to metadata", testURL(server, "/redirect?to=http://169.254.169.254/latest/meta-data")},
+		{"redirect to private literal", testURL(server, "/redirect?to=http://10.0.0.1/feed")},
+		{"redirect to loopback after DNS", testURL(server, "/redirect?to=http://localhost:"+port+"/feed")},
+		{"redirect to mapped loopback", testURL(server, "/redirect?to=http://[::ffff:127.0.0.1]:"+port+"/feed")},
+		{"redirect to denied host", testURL(server, "/redirect?to=http://denied.test/feed")},
+		{"redirect to file", testURL(server, "/redirect?to=file:///etc/passwd")},
+		{"too many redirects", testURL(server, "/hops/"+strconv.Itoa(DefaultMaxRedirects+1))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := FetchFeed(context.Background(), client, test.url, FeedState{})
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("FetchFeed(%s) = %v, want a *PolicyError", test.url, err)
+			}
+			if Retryable(err) {
+				t.Errorf("refusal %v is retryable", err)
+			}
+		})
+	}
+}
+
+func TestFetchClientAllows(t *testing.T) {
+	server := newTestServer(t)
+	client := testClient(DefaultFetchPolicy(), server)
+	for _, path := range []string{"/feed", "/hops/" + strconv.Itoa(DefaultMaxRedirects-1)} {
+		result, err := FetchFeed(context.Background(), client, testURL(server, path), FeedState{})
+		if err != nil {
+			t.Fatalf("FetchFeed(%s) = %v", path, err)
+		}
+		if !strings.Contains(string(result.Body), "<rss") {
+			t.Errorf("FetchFeed(%s) body = %q", path, result.Body)
+		}
+	}
+
+	policy := DefaultFetchPolicy()
+	policy.AllowPrivate = true
+	result, err := FetchFeed(context.Background(), testClient(policy, server), server.URL+"/feed", FeedState{})
+	if err != nil || result.StatusCode != http.StatusOK {
+		t.Errorf("FetchFeed with AllowPrivate = %v, %v", result.StatusCode, err)
+	}
+}
+
+func TestFetchClientBodyLimit(t *testing.T) {
+	server := newTestServer(t)
+	policy := DefaultFetchPolicy()
+	policy.MaxBodyBytes = 1000
+	client := testClient(policy, server)
+
+	for _, path := range []string{"/large", "/chunked"} {
+		_, err := FetchFeed(context.Background(), client, testURL(server, path), FeedState{})
+		var sizeErr *BodyTooLargeError
+		if !errors.As(err, &sizeErr) || sizeErr.Limit != 1000 {
+			t.Errorf("FetchFeed(%s) = %v, want a *BodyTooLargeError", path, err)
+		}
+		if Retryable(err) {
+			t.Errorf("FetchFeed(%s): oversized body is retryable", path)
+		}
+	}
+
+	if _, err := FetchFeed(context.Background(), client, testURL(server, "/feed"), FeedState{}); err != nil {
+		t.Errorf("FetchFeed(/feed) under the limit = %v", err)
+	}
+}
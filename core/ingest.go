@@ -0,0 +1,346 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultIngestWorkers = 8
+	DefaultFeedTimeout   = 30 * time.Second
+)
+
+const (
+	StageFetch = "fetch"
+	StageParse = "parse"
+	StageStore = "store"
+)
+
+// IngestError is a failure that stopped the ingestion of a feed. Stage tells
+// which step failed.
+type IngestError struct {
+	Stage string
+	Err   error
+}
+
+func (err *IngestError) Error() string {
+	return err.Stage + ": " + err.Err.Error()
+}
+
+func (err *IngestError) Unwrap() error {
+	return err.Err
+}
+
+type ItemError struct {
+	Id     string `json:"id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ItemLink is an item that was not stored as it tells the story of the
+// Canonical item, named by "partitionKey/rowKey", found at CanonicalURL.
+type ItemLink struct {
+	Id           string `json:"id,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Canonical    string `json:"canonical"`
+	CanonicalURL string `json:"canonicalUrl,omitempty"`
+}
+
+type IngestTimings struct {
+	FetchMs int64 `json:"fetchMs"`
+	ParseMs int64 `json:"parseMs"`
+	StoreMs int64 `json:"storeMs"`
+}
+
+// Values of IngestReport.Skipped.
+const (
+	// SkipNotModified: the server answered the conditional GET with 304.
+	SkipNotModified = "not_modified"
+	// SkipUnchanged: the body hashes to the same value as last time.
+	SkipUnchanged = "unchanged"
+)
+
+// IngestReport summarizes one feed ingestion. Fetched counts the items in
+// the document and Parsed those that were usable. Every fetched item ends up
+// Inserted, skipped as one of the Duplicates, Linked to the canonical item
+// of the same story from another feed, or Failed; Links names the canonical
+// item of each linked item and Errors the reason of each failure. Skipped is
+// set when the feed did not change since the last ingestion and was not
+// parsed.
+type IngestReport struct {
+	URL        string        `json:"url"`
+	Feed       FeedMetadata  `json:"feed"`
+	Skipped    string        `json:"skipped,omitempty"`
+	Fetched    int           `json:"fetched"`
+	Parsed     int           `json:"parsed"`
+	Inserted   int           `json:"inserted"`
+	Duplicates int           `json:"duplicates"`
+	Linked     int           `json:"linked"`
+	Failed     int           `json:"failed"`
+	Links      []ItemLink    `json:"links,omitempty"`
+	Errors     []ItemError   `json:"errors,omitempty"`
+	Warnings   []ItemError   `json:"warnings,omitempty"`
+	Timings    IngestTimings `json:"timings"`
+}
+
+// IngestTarget is a feed to ingest and the store its items go to, named by
+// Name. When States is set, the fetch is conditional on the state saved for
+// URL and Name by the previous successful ingestion, and a feed that did
+// not change is skipped. When Duplicates is set, items telling a story
+// already stored in Name from another feed are linked to it instead of
+// being stored.
+type IngestTarget struct {
+	URL        string
+	Name       string
+	Store      NewsStore
+	States     FeedStateStore
+	Duplicates DuplicateIndex
+}
+
+// IngestFeed fetches the target feed, parses it and stores the items that
+// are not stored yet. Fatal failures are returned as *IngestError together
+// with the report gathered so far.
+func IngestFeed(ctx context.Context, client *http.Client, target IngestTarget) (report IngestReport, err error) {
+	feedURL, store, states := target.URL, target.Store, target.States
+	report.URL = feedURL
+
+	var state FeedState
+	if states != nil {
+		if state, _, err = states.GetFeedState(ctx, target.Name, feedURL); err != nil {
+			return report, &IngestError{Stage: StageStore, Err: fmt.Errorf("reading feed state: %w", err)}
+		}
+	}
+
+	start := time.Now()
+	fetched, err := FetchFeed(ctx, client, feedURL, state)
+	report.Timings.FetchMs = time.Since(start).Milliseconds()
+	if err != nil {
+		return report, &IngestError{Stage: StageFetch, Err: err}
+	}
+	if fetched.NotModified {
+		report.Skipped = SkipNotModified
+		return report, nil
+	}
+	hash := ContentHash(fetched.Body)
+	if hash == state.ContentHash {
+		report.Skipped = SkipUnchanged
+		if fetched.ETag != state.ETag || fetched.LastModified != state.LastModified {
+			report.saveState(ctx, target, fetched, hash)
+		}
+		return report, nil
+	}
+
+	start = time.Now()
+	feed, err := ParseFeed(fetched.ContentType, fetched.Body, fetched.FetchedAt)
+	report.Timings.ParseMs = time.Since(start).Milliseconds()
+	if err != nil {
+		return report, &IngestError{Stage: StageParse, Err: err}
+	}
+	report.Feed = feed.FeedMetadata
+	report.Fetched = len(feed.Items)
+
+	var items []News
+	for _, item := range feed.Items {
+		if item.Title == "" && item.Link == "" && item.Id == "" {
+			report.addError(item, "item has no title, link or guid")
+			continue
+		}
+		if item.DateEstimated {
+			report.Warnings = append(report.Warnings, ItemError{Id: item.Id, Title: item.Title, Reason: "date not recognized, using fetch time"})
+		}
+		item.Source = feedURL
+		items = append(items, item)
+	}
+	report.Parsed = len(items)
+
+	start = time.Now()
+	defer func() { report.Timings.StoreMs = time.Since(start).Milliseconds() }()
+	items, err = report.skipDuplicates(ctx, store, items)
+	if err != nil {
+		return report, &IngestError{Stage: StageStore, Err: err}
+	}
+	var fingerprints, links []Fingerprint
+	if target.Duplicates != nil {
+		items, fingerprints, links = report.linkDuplicates(ctx, target, items)
+	}
+	if len(items) == 0 {
+		report.indexItems(ctx, target, links, nil, nil, nil)
+		report.saveState(ctx, target, fetched, hash)
+		return report, nil
+	}
+
+	err = store.InsertBatch(ctx, items)
+	var batchErr *BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		report.Failed += len(items)
+		return report, &IngestError{Stage: StageStore, Err: err}
+	}
+	report.Inserted = len(items)
+	if batchErr != nil {
+		for _, failure := range batchErr.Failures {
+			report.addError(failure.Item, failure.Err.Error())
+		}
+		report.Inserted -= len(batchErr.Failures)
+	}
+	if report.Inserted == 0 {
+		return report, &IngestError{Stage: StageStore, Err: err}
+	}
+	report.indexItems(ctx, target, links, items, fingerprints, batchErr)
+	// Items that failed to store are retried on the next fetch only if the
+	// state is left as it was.
+	if batchErr == nil {
+		report.saveState(ctx, target, fetched, hash)
+	}
+	return report, nil
+}
+
+// saveState remembers the validators and hash of fetched. The items are
+// already stored at this point, so a failure is only reported as a warning.
+func (report *IngestReport) saveState(ctx context.Context, target IngestTarget, fetched FetchResult, hash string) {
+	if target.States == nil {
+		return
+	}
+	err := target.States.PutFeedState(ctx, FeedState{
+		URL:          target.URL,
+		Target:       target.Name,
+		ETag:         fetched.ETag,
+		LastModified: fetched.LastModified,
+		ContentHash:  hash,
+		UpdatedAt:    fetched.FetchedAt.UTC(),
+	})
+	if err != nil {
+		report.Warnings = append(report.Warnings, ItemError{Reason: "saving feed state: " + err.Error()})
+	}
+}
+
+type IngestResult struct {
+	Report IngestReport
+	Err    error
+}
+
+// IngestFeeds ingests targets with at most workers feeds in flight, each
+// limited to timeout. Results are in the order of targets; a failed feed
+// only fails its own result.
+func IngestFeeds(ctx context.Context, client *http.Client, targets []IngestTarget, workers int, timeout time.Duration) []IngestResult {
+	if workers <= 0 {
+		workers = DefaultIngestWorkers
+	}
+	if timeout <= 0 {
+		timeout = DefaultFeedTimeout
+	}
+	results := make([]IngestResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(targets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				feedCtx, cancel := context.WithTimeout(ctx, timeout)
+				report, err := IngestFeed(feedCtx, client, targets[i])
+				cancel()
+				results[i] = IngestResult{Report: report, Err: err}
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// skipDuplicates drops items repeated within the feed or already stored.
+func (report *IngestReport) skipDuplicates(ctx context.Context, store NewsStore, items []News) ([]News, error) {
+	existing, err := store.Existing(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var fresh []News
+	for i, item := range items {
+		key := storeKey(NewsKeys(item))
+		if existing[i] || seen[key] {
+			report.Duplicates++
+			continue
+		}
+		seen[key] = true
+		fresh = append(fresh, item)
+	}
+	return fresh, nil
+}
+
+// linkDuplicates drops the items that duplicate an item of another feed in
+// the index. It returns the other items with their fingerprints, and the
+// fingerprints of the links to record once the items are stored. The index
+// only saves storage, so its failures are warnings and all items are kept.
+func (report *IngestReport) linkDuplicates(ctx context.Context, target IngestTarget, items []News) ([]News, []Fingerprint, []Fingerprint) {
+	all := make([]Fingerprint, len(items))
+	for i, item := range items {
+		all[i] = FingerprintOf(target.Name, item)
+	}
+	candidates, err := target.Duplicates.Candidates(ctx, all)
+	if err != nil {
+		report.Warnings = append(report.Warnings, ItemError{Reason: "finding duplicates: " + err.Error()})
+		return items, all, nil
+	}
+
+	var fresh []News
+	var fingerprints, links []Fingerprint
+	for i, item := range items {
+		fp := all[i]
+		match, ok := fp.Match(candidates)
+		if !ok {
+			fresh = append(fresh, item)
+			fingerprints = append(fingerprints, fp)
+			continue
+		}
+		if match.Key == fp.Key {
+			// Linked by a previous ingestion.
+			report.Duplicates++
+			continue
+		}
+		fp.Canonical, fp.CanonicalURL = match.canonical()
+		links = append(links, fp)
+		report.Linked++
+		report.Links = append(report.Links, ItemLink{Id: item.Id, Title: item.Title, Canonical: fp.Canonical, CanonicalURL: fp.CanonicalURL})
+	}
+	return fresh, fingerprints, links
+}
+
+// indexItems adds links and the fingerprints of the stored items to the
+// index in one write, so that later items of other feeds are linked to
+// them.
+func (report *IngestReport) indexItems(ctx context.Context, target IngestTarget, links []Fingerprint, items []News, fingerprints []Fingerprint, batchErr *BatchError) {
+	if target.Duplicates == nil {
+		return
+	}
+	failed := map[string]bool{}
+	if batchErr != nil {
+		for _, failure := range batchErr.Failures {
+			failed[storeKey(NewsKeys(failure.Item))] = true
+		}
+	}
+	indexed := links
+	for i, item := range items {
+		if !failed[storeKey(NewsKeys(item))] {
+			indexed = append(indexed, fingerprints[i])
+		}
+	}
+	if len(indexed) == 0 {
+		return
+	}
+	if err := target.Duplicates.AddFingerprints(ctx, indexed); err != nil {
+		report.Warnings = append(report.Warnings, ItemError{Reason: "indexing items: " + err.Error()})
+	}
+}
+
+func (report *IngestReport) addError(item News, reason string) {
+	report.Failed++
+	report.Errors = append(report.Errors, ItemError{Id: item.Id, Title: item.Title, Reason: reason})
+}
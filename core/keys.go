@@ -0,0 +1,60 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// Longest guid kept verbatim in a row key; longer ones are hashed so the
+// key stays under the 1 KiB limit of Table storage.
+const maxGuidKeyLength = 512
+
+// NewsKeys returns the deterministic partition and row key of item, so
+// re-ingesting a feed overwrites the same rows instead of adding new ones.
+//
+// The partition key is the feed host, e.g. "dorzeczy.pl". It does not
+// depend on the item date, which is the fetch time of undated items and
+// changes when an Atom entry without <published> is updated. A partition
+// holds the whole history of a host, so stored items are looked up by point
+// reads of both keys (see TableStore.Existing), not by filters within it.
+//
+// The row key is "g-" followed by the URL-safe base64 of the guid; "s-"
+// followed by a SHA-256 of the guid when it is longer than
+// maxGuidKeyLength; or "h-" followed by a SHA-256 of link and title when
+// the item has no guid. Base64 is used because guids are often URLs and '/'
+// is not allowed in Table storage keys.
+func NewsKeys(item News) (partitionKey string, rowKey string) {
+	host := hostOf(item.Source)
+	if host == "" {
+		host = hostOf(item.Link)
+	}
+	if host == "" {
+		host = "unknown"
+	}
+	partitionKey = host
+
+	id := strings.TrimSpace(item.Id)
+	switch {
+	case id != "" && len(id) <= maxGuidKeyLength:
+		rowKey = "g-" + base64.RawURLEncoding.EncodeToString([]byte(id))
+	case id != "":
+		sum := sha256.Sum256([]byte(id))
+		rowKey = "s-" + hex.EncodeToString(sum[:])
+	default:
+		sum := sha256.Sum256([]byte(strings.TrimSpace(item.Link) + "\n" + strings.TrimSpace(item.Title)))
+		rowKey = "h-" + hex.EncodeToString(sum[:])
+	}
+
+	return partitionKey, rowKey
+}
+
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Host)
+}
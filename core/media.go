@@ -0,0 +1,168 @@
+package core
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// rssMedia returns the enclosures, Media RSS elements and itunes:image of an
+// RSS item. Relative urls are resolved against link, the item link; media
+// whose url is not http(s) are dropped, as images of descriptions are.
+func rssMedia(item AtomEntry, link string) []Media {
+	base, _ := url.Parse(link)
+	var media []Media
+	duration := parseDuration(item.ItunesDuration)
+	for _, enclosure := range item.Enclosures {
+		mediaURL := resolveURL(base, enclosure.URL, false)
+		if mediaURL == "" {
+			continue
+		}
+		media = append(media, Media{
+			Rel:      MediaRelEnclosure,
+			URL:      mediaURL,
+			Type:     enclosure.Type,
+			Size:     parseInt64(enclosure.Length),
+			Duration: duration,
+		})
+	}
+
+	media = append(media, mediaRSS(base, item.MediaContents, item.MediaThumbnails, item.MediaGroups)...)
+	if imageURL := resolveURL(base, item.ItunesImage.Href, false); imageURL != "" {
+		media = append(media, Media{
+			Rel:    MediaRelThumbnail,
+			URL:    imageURL,
+			Medium: "image",
+		})
+	}
+	return media
+}
+
+// mediaRSS flattens media:content and media:thumbnail elements, including
+// those nested in media:group and media:content, resolving their urls
+// against base.
+func mediaRSS(base *url.URL, contents []MediaContent, thumbnails []MediaThumbnail, groups []MediaGroup) []Media {
+	var media []Media
+	for _, group := range groups {
+		contents = append(contents, group.Contents...)
+		thumbnails = append(thumbnails, group.Thumbnails...)
+	}
+	for _, content := range contents {
+		if contentURL := resolveURL(base, content.URL, false); contentURL != "" {
+			media = append(media, Media{
+				Rel:      MediaRelContent,
+				URL:      contentURL,
+				Type:     content.Type,
+				Medium:   content.Medium,
+				Size:     parseInt64(content.FileSize),
+				Width:    parseInt(content.Width),
+				Height:   parseInt(content.Height),
+				Duration: parseDuration(content.Duration),
+			})
+		}
+		thumbnails = append(thumbnails, content.Thumbnails...)
+	}
+	for _, thumbnail := range thumbnails {
+		thumbnailURL := resolveURL(base, thumbnail.URL, false)
+		if thumbnailURL == "" {
+			continue
+		}
+		media = append(media, Media{
+			Rel:    MediaRelThumbnail,
+			URL:    thumbnailURL,
+			Medium: "image",
+			Width:  parseInt(thumbnail.Width),
+			Height: parseInt(thumbnail.Height),
+		})
+	}
+	return media
+}
+
+// atomMedia returns the enclosure links and Media RSS elements of an Atom
+// entry, resolved against link like rssMedia.
+func atomMedia(entry AtomFeedEntry, link string) []Media {
+	base, _ := url.Parse(link)
+	var media []Media
+	for _, enclosure := range entry.Links {
+		if enclosure.Rel != "enclosure" {
+			continue
+		}
+		enclosureURL := resolveURL(base, enclosure.Href, false)
+		if enclosureURL == "" {
+			continue
+		}
+		media = append(media, Media{
+			Rel:  MediaRelEnclosure,
+			URL:  enclosureURL,
+			Type: enclosure.Type,
+			Size: parseInt64(enclosure.Length),
+		})
+	}
+	return append(media, mediaRSS(base, entry.MediaContents, entry.MediaThumbnails, entry.MediaGroups)...)
+}
+
+// jsonFeedMedia returns the attachments and image of a JSON Feed item,
+// resolved against link like rssMedia.
+func jsonFeedMedia(item JSONFeedItem, link string) []Media {
+	base, _ := url.Parse(link)
+	var media []Media
+	for _, attachment := range item.Attachments {
+		attachmentURL := resolveURL(base, attachment.URL, false)
+		if attachmentURL == "" {
+			continue
+		}
+		media = append(media, Media{
+			Rel:      MediaRelEnclosure,
+			URL:      attachmentURL,
+			Type:     attachment.MimeType,
+			Size:     attachment.SizeInBytes,
+			Duration: attachment.DurationInSeconds,
+		})
+	}
+	if imageURL := resolveURL(base, item.Image, false); imageURL != "" {
+		media = append(media, Media{
+			Rel:    MediaRelThumbnail,
+			URL:    imageURL,
+			Medium: "image",
+		})
+	}
+	return media
+}
+
+// firstImage returns the url of the first thumbnail or image of media.
+func firstImage(media []Media) string {
+	for _, m := range media {
+		if m.Rel == MediaRelThumbnail || m.Medium == "image" || strings.HasPrefix(m.Type, "image/") {
+			return m.URL
+		}
+	}
+	return ""
+}
+
+// parseDuration accepts seconds ("195", "195.5") and the clock format used
+// by itunes:duration ("3:15", "01:03:15").
+func parseDuration(value string) float64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	var seconds float64
+	for _, part := range strings.Split(value, ":") {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil || number < 0 {
+			return 0
+		}
+		seconds = seconds*60 + number
+	}
+	return seconds
+}
+
+func parseInt(value string) int {
+	number, _ := strconv.Atoi(strings.TrimSpace(value))
+	return number
+}
+
+func parseInt64(value string) int64 {
+	number, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return number
+}
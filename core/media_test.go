@@ -0,0 +1,45 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFeedMediaURLs(t *testing.T) {
+	const rss = `<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/"><channel><title>T</title><item>
+<title>A</title><link>https://news.example.com/a/item.html</link>
+<enclosure url="/audio/a.mp3" type="audio/mpeg" length="10"/>
+<enclosure url="data:audio/mpeg;base64,AAAA" type="audio/mpeg"/>
+<media:content url="javascript:alert(1)" medium="image"/>
+<media:thumbnail url="//cdn.example.com/t.jpg"/>
+<media:thumbnail url="ftp://cdn.example.com/t.jpg"/>
+</item></channel></rss>`
+	feed, err := ParseFeed("application/rss+xml", []byte(rss), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://news.example.com/audio/a.mp3", "https://cdn.example.com/t.jpg"}
+	media := feed.Items[0].Media
+	if len(media) != len(want) {
+		t.Fatalf("Media = %+v, want urls %v", media, want)
+	}
+	for i, m := range media {
+		if m.URL != want[i] {
+			t.Errorf("Media[%d].URL = %q, want %q", i, m.URL, want[i])
+		}
+	}
+
+	const jsonFeed = `{"version": "https://jsonfeed.org/version/1.1", "items": [{"id": "1", "url": "https://news.example.com/a/",
+"image": "javascript:alert(1)", "attachments": [{"url": "p.mp3", "mime_type": "audio/mpeg"}, {"url": "data:text/html,x"}]}]}`
+	feed, err = ParseFeed("application/feed+json", []byte(jsonFeed), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	media = feed.Items[0].Media
+	if len(media) != 1 || media[0].URL != "https://news.example.com/a/p.mp3" {
+		t.Errorf("JSON Feed Media = %+v", media)
+	}
+	if feed.Items[0].Image != "" {
+		t.Errorf("JSON Feed Image = %q", feed.Items[0].Image)
+	}
+}
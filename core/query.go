@@ -0,0 +1,127 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultQueryLimit = 50
+	MaxQueryLimit     = 1000
+)
+
+// NewsQuery filters stored news. Zero fields do not filter. From is
+// inclusive and To exclusive. Continuation is the token of the previous page.
+type NewsQuery struct {
+	Feed         string
+	From         time.Time
+	To           time.Time
+	Category     string
+	Limit        int
+	Continuation string
+}
+
+type NewsPage struct {
+	Items        []News `json:"items"`
+	Continuation string `json:"continuation,omitempty"`
+}
+
+// continuation is the key of the first entity of the next page.
+type continuation struct {
+	PartitionKey string `json:"pk"`
+	RowKey       string `json:"rk"`
+}
+
+func encodeContinuation(partitionKey, rowKey string) string {
+	data, _ := json.Marshal(continuation{PartitionKey: partitionKey, RowKey: rowKey})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ErrInvalidContinuation is returned by NewsStore.Query for a continuation
+// token it did not issue.
+var ErrInvalidContinuation = errors.New("invalid continuation token")
+
+func decodeContinuation(token string) (continuation, error) {
+	position := continuation{}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &position)
+	}
+	if err != nil || position.PartitionKey == "" {
+		return continuation{}, ErrInvalidContinuation
+	}
+	return position, nil
+}
+
+func (query NewsQuery) limit() int {
+	if query.Limit <= 0 {
+		return DefaultQueryLimit
+	}
+	return min(query.Limit, MaxQueryLimit)
+}
+
+// filter returns the OData filter for the Feed, From and To fields.
+// Categories are stored as a JSON string and are matched by Matches instead.
+func (query NewsQuery) filter() string {
+	var clauses []string
+	if query.Feed != "" {
+		clauses = append(clauses, "Source eq "+odataString(query.Feed))
+	}
+	if !query.From.IsZero() {
+		clauses = append(clauses, "Date ge datetime'"+query.From.UTC().Format(time.RFC3339)+"'")
+	}
+	if !query.To.IsZero() {
+		clauses = append(clauses, "Date lt datetime'"+query.To.UTC().Format(time.RFC3339)+"'")
+	}
+	return strings.Join(clauses, " and ")
+}
+
+// Matches reports whether item passes all filters of the query.
+func (query NewsQuery) Matches(item News) bool {
+	if query.Feed != "" && item.Source != query.Feed {
+		return false
+	}
+	if !query.From.IsZero() && item.Date.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !item.Date.Before(query.To) {
+		return false
+	}
+	if query.Category != "" && !slices.ContainsFunc(item.Categories, func(category string) bool {
+		return strings.EqualFold(category, query.Category)
+	}) {
+		return false
+	}
+	return true
+}
+
+func odataString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// storeKey and splitStoreKey convert between NewsKeys and the keys used by
+// the memory and bolt stores, which sort in partition and row key order.
+func storeKey(partitionKey, rowKey string) string {
+	return partitionKey + "\x00" + rowKey
+}
+
+func splitStoreKey(key string) (partitionKey, rowKey string) {
+	partitionKey, rowKey, _ = strings.Cut(key, "\x00")
+	return partitionKey, rowKey
+}
+
+// startKey returns the store key a page starts from.
+func (query NewsQuery) startKey() (string, error) {
+	if query.Continuation == "" {
+		return "", nil
+	}
+	position, err := decodeContinuation(query.Continuation)
+	if err != nil {
+		return "", err
+	}
+	return storeKey(position.PartitionKey, position.RowKey), nil
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Storage queues of the ingestion pipeline. Messages that keep failing are
+// moved to the poison queue, by the handler or by the Functions host after
+// maxDequeueCount attempts.
+const (
+	IngestQueue       = "feed-ingest"
+	IngestPoisonQueue = IngestQueue + "-poison"
+)
+
+// IngestMessage asks for one feed to be ingested into Target, the name of a
+// store. SubscriptionID is set for registered feeds so that the outcome can
+// be recorded.
+type IngestMessage struct {
+	URL            string `json:"url"`
+	Target         string `json:"target"`
+	SubscriptionID string `json:"subscriptionId,omitempty"`
+}
+
+// Retryable reports whether a failed ingestion may succeed when tried
+// again. Feeds that cannot be parsed or are refused by the fetch policy,
+// and client errors other than timeouts and throttling are permanent.
+func Retryable(err error) bool {
+	if refused(err) {
+		return false
+	}
+	var ingestErr *IngestError
+	if errors.As(err, &ingestErr) && ingestErr.Stage == StageParse {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return retryStatus(statusErr.StatusCode)
+	}
+	return true
+}
+
+// ClaimDue returns the due subscriptions of registry and marks them checked
+// at now, so that they are not handed out again before their interval
+// elapses. The outcome is recorded later by whoever ingests them.
+func ClaimDue(ctx context.Context, registry FeedRegistry, now time.Time) ([]Subscription, error) {
+	subs, err := registry.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var due []Subscription
+	for _, sub := range subs {
+		if !sub.Due(now) {
+			continue
+		}
+		sub.LastChecked = now.UTC()
+		if err := registry.PutSubscription(ctx, sub); err != nil {
+			return due, err
+		}
+		due = append(due, sub)
+	}
+	return due, nil
+}
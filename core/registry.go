@@ -0,0 +1,391 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// FeedsTable is the default table of the feed registry.
+	FeedsTable = "feeds"
+	// DefaultIntervalMinutes is the polling interval of a subscription that
+	// does not set one.
+	DefaultIntervalMinutes = 60
+)
+
+// All subscriptions share one partition; a registry holds tens of feeds,
+// not thousands.
+const subscriptionPartition = "feed"
+
+// Subscription is a feed registered for periodic ingestion into Target, the
+// name of a store. The Last* fields and ConsecutiveFailures are maintained
+// by IngestDue.
+type Subscription struct {
+	ID                  string    `json:"id"`
+	URL                 string    `json:"url"`
+	Target              string    `json:"target"`
+	IntervalMinutes     int       `json:"intervalMinutes"`
+	Enabled             bool      `json:"enabled"`
+	LastChecked         time.Time `json:"lastChecked,omitzero"`
+	LastSuccess         time.Time `json:"lastSuccess,omitzero"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+}
+
+// SubscriptionID derives the id of a new subscription from its URL and
+// target, so registering the same feed twice is detected.
+func SubscriptionID(feedURL, target string) string {
+	sum := sha256.Sum256([]byte(feedURL + "\n" + target))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Due reports whether sub is enabled and was not checked within its
+// interval.
+func (sub Subscription) Due(now time.Time) bool {
+	if !sub.Enabled {
+		return false
+	}
+	interval := sub.IntervalMinutes
+	if interval <= 0 {
+		interval = DefaultIntervalMinutes
+	}
+	return !now.Before(sub.LastChecked.Add(time.Duration(interval) * time.Minute))
+}
+
+// Record updates the status fields of sub with the outcome of an ingestion
+// that ended at checkedAt.
+func (sub *Subscription) Record(checkedAt time.Time, err error) {
+	sub.LastChecked = checkedAt.UTC()
+	if err != nil {
+		sub.LastError = err.Error()
+		sub.ConsecutiveFailures++
+		return
+	}
+	sub.LastSuccess = sub.LastChecked
+	sub.LastError = ""
+	sub.ConsecutiveFailures = 0
+}
+
+// FeedRegistry stores subscriptions by id.
+type FeedRegistry interface {
+	// ListSubscriptions returns all subscriptions ordered by id.
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	GetSubscription(ctx context.Context, id string) (sub Subscription, found bool, err error)
+	PutSubscription(ctx context.Context, sub Subscription) error
+	// DeleteSubscription removes the subscription; deleting a missing id
+	// is not an error.
+	DeleteSubscription(ctx context.Context, id string) error
+}
+
+func OpenFeedRegistry(config StoreConfig) (FeedRegistry, error) {
+	switch config.Backend {
+	case "", StoreTable:
+		client, err := OpenTableClient(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewTableFeedRegistry(client), nil
+	case StoreMemory:
+		return OpenMemoryFeedRegistry(config.Table), nil
+	case StoreBolt:
+		return OpenBoltFeedRegistry(config.Path, config.Table)
+	}
+	return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+}
+
+// DueResult is the outcome of one subscription ingested by IngestDue.
+type DueResult struct {
+	Subscription Subscription
+	IngestResult
+}
+
+// IngestDue ingests every due subscription of registry, at most workers at
+// a time, and saves each subscription with its outcome recorded. targets
+// returns the stores of a subscription's target, as an IngestTarget
+// without URL.
+func IngestDue(ctx context.Context, client *http.Client, registry FeedRegistry, targets func(target string) (IngestTarget, error),
+	workers int, timeout time.Duration) ([]DueResult, error) {
+	subs, err := registry.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var results []DueResult
+	var ingested []IngestTarget
+	var indexes []int
+	opened := map[string]IngestTarget{}
+	for _, sub := range subs {
+		if !sub.Due(now) {
+			continue
+		}
+		result := DueResult{Subscription: sub}
+		result.Report.URL = sub.URL
+		target, ok := opened[sub.Target]
+		if !ok {
+			if target, err = targets(sub.Target); err != nil {
+				result.Err = &IngestError{Stage: StageStore, Err: err}
+				results = append(results, result)
+				continue
+			}
+			opened[sub.Target] = target
+		}
+		target.URL, target.Name = sub.URL, sub.Target
+		results = append(results, result)
+		ingested = append(ingested, target)
+		indexes = append(indexes, len(results)-1)
+	}
+
+	for j, result := range IngestFeeds(ctx, client, ingested, workers, timeout) {
+		results[indexes[j]].IngestResult = result
+	}
+	for i := range results {
+		result := &results[i]
+		result.Subscription.Record(time.Now(), result.Err)
+		if err := registry.PutSubscription(ctx, result.Subscription); err != nil {
+			result.Report.Warnings = append(result.Report.Warnings, ItemError{Reason: "saving subscription: " + err.Error()})
+		}
+	}
+	return results, nil
+}
+
+// TableFeedRegistry keeps subscriptions in Azure Table storage or the
+// Cosmos DB Table API.
+type TableFeedRegistry struct {
+	client *aztables.Client
+}
+
+func NewTableFeedRegistry(client *aztables.Client) *TableFeedRegistry {
+	return &TableFeedRegistry{client: client}
+}
+
+func (registry *TableFeedRegistry) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	var subs []Subscription
+	pager := registry.client.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: to.Ptr("PartitionKey eq " + odataString(subscriptionPartition)),
+	})
+	for pager.More() {
+		response, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range response.Entities {
+			sub, err := subscriptionFromEntity(data)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func (registry *TableFeedRegistry) GetSubscription(ctx context.Context, id string) (Subscription, bool, error) {
+	response, err := registry.client.GetEntity(ctx, subscriptionPartition, id, nil)
+	if isNotFound(err) {
+		return Subscription{}, false, nil
+	}
+	if err != nil {
+		return Subscription{}, false, err
+	}
+	sub, err := subscriptionFromEntity(response.Value)
+	return sub, err == nil, err
+}
+
+func (registry *TableFeedRegistry) PutSubscription(ctx context.Context, sub Subscription) error {
+	props := map[string]any{
+		"URL":                 sub.URL,
+		"Target":              sub.Target,
+		"IntervalMinutes":     int32(sub.IntervalMinutes),
+		"Enabled":             sub.Enabled,
+		"LastError":           sub.LastError,
+		"ConsecutiveFailures": int32(sub.ConsecutiveFailures),
+	}
+	// Table storage rejects dates before 1601, so unset times are left out.
+	if !sub.LastChecked.IsZero() {
+		props["LastChecked"] = aztables.EDMDateTime(sub.LastChecked)
+	}
+	if !sub.LastSuccess.IsZero() {
+		props["LastSuccess"] = aztables.EDMDateTime(sub.LastSuccess)
+	}
+	data, err := json.Marshal(aztables.EDMEntity{
+		Entity: aztables.Entity{
+			PartitionKey: subscriptionPartition,
+			RowKey:       sub.ID,
+		},
+		Properties: props,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = registry.client.UpsertEntity(ctx, data, &aztables.UpsertEntityOptions{UpdateMode: aztables.UpdateModeReplace})
+	return err
+}
+
+func (registry *TableFeedRegistry) DeleteSubscription(ctx context.Context, id string) error {
+	_, err := registry.client.DeleteEntity(ctx, subscriptionPartition, id, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func subscriptionFromEntity(data []byte) (Subscription, error) {
+	entity := aztables.EDMEntity{}
+	if err := json.Unmarshal(data, &entity); err != nil {
+		return Subscription{}, err
+	}
+	props := entity.Properties
+	sub := Subscription{
+		ID:        entity.RowKey,
+		URL:       stringProperty(props, "URL"),
+		Target:    stringProperty(props, "Target"),
+		LastError: stringProperty(props, "LastError"),
+	}
+	interval, _ := props["IntervalMinutes"].(int32)
+	sub.IntervalMinutes = int(interval)
+	failures, _ := props["ConsecutiveFailures"].(int32)
+	sub.ConsecutiveFailures = int(failures)
+	sub.Enabled, _ = props["Enabled"].(bool)
+	if checked, ok := props["LastChecked"].(aztables.EDMDateTime); ok {
+		sub.LastChecked = time.Time(checked)
+	}
+	if success, ok := props["LastSuccess"].(aztables.EDMDateTime); ok {
+		sub.LastSuccess = time.Time(success)
+	}
+	return sub, nil
+}
+
+func isNotFound(err error) bool {
+	var responseErr *azcore.ResponseError
+	return errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound
+}
+
+var (
+	memoryRegistries   = map[string]*MemoryFeedRegistry{}
+	memoryRegistriesMu sync.Mutex
+)
+
+// MemoryFeedRegistry keeps subscriptions in process memory.
+type MemoryFeedRegistry struct {
+	mu   sync.RWMutex
+	subs map[string]Subscription
+}
+
+// OpenMemoryFeedRegistry returns the process-wide registry of table,
+// creating it on first use.
+func OpenMemoryFeedRegistry(table string) *MemoryFeedRegistry {
+	memoryRegistriesMu.Lock()
+	defer memoryRegistriesMu.Unlock()
+
+	registry, ok := memoryRegistries[table]
+	if !ok {
+		registry = &MemoryFeedRegistry{subs: map[string]Subscription{}}
+		memoryRegistries[table] = registry
+	}
+	return registry
+}
+
+func (registry *MemoryFeedRegistry) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	subs := make([]Subscription, 0, len(registry.subs))
+	for _, sub := range registry.subs {
+		subs = append(subs, sub)
+	}
+	slices.SortFunc(subs, func(a, b Subscription) int { return strings.Compare(a.ID, b.ID) })
+	return subs, nil
+}
+
+func (registry *MemoryFeedRegistry) GetSubscription(ctx context.Context, id string) (Subscription, bool, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	sub, found := registry.subs[id]
+	return sub, found, nil
+}
+
+func (registry *MemoryFeedRegistry) PutSubscription(ctx context.Context, sub Subscription) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.subs[sub.ID] = sub
+	return nil
+}
+
+func (registry *MemoryFeedRegistry) DeleteSubscription(ctx context.Context, id string) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.subs, id)
+	return nil
+}
+
+// BoltFeedRegistry keeps subscriptions as JSON in a bucket of a BoltDB file.
+type BoltFeedRegistry struct {
+	store *BoltStore
+}
+
+func OpenBoltFeedRegistry(path string, table string) (*BoltFeedRegistry, error) {
+	store, err := OpenBoltStore(path, table)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltFeedRegistry{store: store}, nil
+}
+
+func (registry *BoltFeedRegistry) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	var subs []Subscription
+	err := registry.store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(registry.store.bucket).ForEach(func(key, data []byte) error {
+			var sub Subscription
+			if err := json.Unmarshal(data, &sub); err != nil {
+				return err
+			}
+			subs = append(subs, sub)
+			return nil
+		})
+	})
+	return subs, err
+}
+
+func (registry *BoltFeedRegistry) GetSubscription(ctx context.Context, id string) (Subscription, bool, error) {
+	var sub Subscription
+	var found bool
+	err := registry.store.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(registry.store.bucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &sub)
+	})
+	return sub, found, err
+}
+
+func (registry *BoltFeedRegistry) PutSubscription(ctx context.Context, sub Subscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return registry.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(registry.store.bucket).Put([]byte(sub.ID), data)
+	})
+}
+
+func (registry *BoltFeedRegistry) DeleteSubscription(ctx context.Context, id string) error {
+	return registry.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(registry.store.bucket).Delete([]byte(id))
+	})
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	bolt "go.etcd.io/bbolt"
+)
+
+// FeedStateTable is the default table keeping the FeedState of every feed.
+const FeedStateTable = "feedstate"
+
+// FeedState is what is remembered about a feed between fetches: the cache
+// validators sent back in a conditional GET and the hash of the last body,
+// for servers that ignore them. A feed ingested into several targets has a
+// state per target.
+type FeedState struct {
+	URL          string    `json:"url"`
+	Target       string    `json:"target"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	ContentHash  string    `json:"contentHash,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// FeedStateStore persists FeedState by target and feed URL.
+type FeedStateStore interface {
+	// GetFeedState returns the state of feedURL in target; found is false
+	// when the feed has not been ingested into target yet.
+	GetFeedState(ctx context.Context, target string, feedURL string) (state FeedState, found bool, err error)
+	PutFeedState(ctx context.Context, state FeedState) error
+}
+
+func OpenFeedStateStore(config StoreConfig) (FeedStateStore, error) {
+	switch config.Backend {
+	case "", StoreTable:
+		client, err := OpenTableClient(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewTableFeedStateStore(client), nil
+	case StoreMemory:
+		return OpenMemoryFeedStateStore(config.Table), nil
+	case StoreBolt:
+		return OpenBoltFeedStateStore(config.Path, config.Table)
+	}
+	return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+}
+
+// ContentHash is the SHA-256 of a feed body, as stored in FeedState.
+func ContentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// feedStateKeys returns the keys of the state of feedURL in target: the
+// feed host as partition and the SHA-256 of target and URL as row, since
+// URLs contain '/'.
+func feedStateKeys(target string, feedURL string) (partitionKey string, rowKey string) {
+	partitionKey = hostOf(feedURL)
+	if partitionKey == "" {
+		partitionKey = "unknown"
+	}
+	sum := sha256.Sum256([]byte(feedStateKey(target, feedURL)))
+	return partitionKey, hex.EncodeToString(sum[:])
+}
+
+func feedStateKey(target string, feedURL string) string {
+	return target + "\n" + feedURL
+}
+
+// TableFeedStateStore keeps feed state in Azure Table storage or the Cosmos
+// DB Table API.
+type TableFeedStateStore struct {
+	client *aztables.Client
+}
+
+func NewTableFeedStateStore(client *aztables.Client) *TableFeedStateStore {
+	return &TableFeedStateStore{client: client}
+}
+
+func (store *TableFeedStateStore) GetFeedState(ctx context.Context, target string, feedURL string) (FeedState, bool, error) {
+	partitionKey, rowKey := feedStateKeys(target, feedURL)
+	response, err := store.client.GetEntity(ctx, partitionKey, rowKey, nil)
+	if isNotFound(err) {
+		return FeedState{}, false, nil
+	}
+	if err != nil {
+		return FeedState{}, false, err
+	}
+
+	var entity aztables.EDMEntity
+	if err := json.Unmarshal(response.Value, &entity); err != nil {
+		return FeedState{}, false, err
+	}
+	state := FeedState{
+		URL:          stringProperty(entity.Properties, "URL"),
+		Target:       stringProperty(entity.Properties, "Target"),
+		ETag:         stringProperty(entity.Properties, "FeedETag"),
+		LastModified: stringProperty(entity.Properties, "LastModified"),
+		ContentHash:  stringProperty(entity.Properties, "ContentHash"),
+	}
+	if updatedAt, ok := entity.Properties["UpdatedAt"].(aztables.EDMDateTime); ok {
+		state.UpdatedAt = time.Time(updatedAt)
+	}
+	return state, true, nil
+}
+
+func (store *TableFeedStateStore) PutFeedState(ctx context.Context, state FeedState) error {
+	partitionKey, rowKey := feedStateKeys(state.Target, state.URL)
+	entity := aztables.EDMEntity{
+		Entity: aztables.Entity{
+			PartitionKey: partitionKey,
+			RowKey:       rowKey,
+		},
+		Properties: map[string]any{
+			"URL":          state.URL,
+			"Target":       state.Target,
+			"FeedETag":     state.ETag,
+			"LastModified": state.LastModified,
+			"ContentHash":  state.ContentHash,
+			"UpdatedAt":    aztables.EDMDateTime(state.UpdatedAt),
+		},
+	}
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+	_, err = store.client.UpsertEntity(ctx, data, nil)
+	return err
+}
+
+var (
+	memoryFeedStates   = map[string]*MemoryFeedStateStore{}
+	memoryFeedStatesMu sync.Mutex
+)
+
+// MemoryFeedStateStore keeps feed state in process memory.
+type MemoryFeedStateStore struct {
+	mu     sync.RWMutex
+	states map[string]FeedState
+}
+
+// OpenMemoryFeedStateStore returns the process-wide feed state store of
+// table, creating it on first use.
+func OpenMemoryFeedStateStore(table string) *MemoryFeedStateStore {
+	memoryFeedStatesMu.Lock()
+	defer memoryFeedStatesMu.Unlock()
+
+	store, ok := memoryFeedStates[table]
+	if !ok {
+		store = &MemoryFeedStateStore{states: map[string]FeedState{}}
+		memoryFeedStates[table] = store
+	}
+	return store
+}
+
+func (store *MemoryFeedStateStore) GetFeedState(ctx context.Context, target string, feedURL string) (FeedState, bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	state, found := store.states[feedStateKey(target, feedURL)]
+	return state, found, nil
+}
+
+func (store *MemoryFeedStateStore) PutFeedState(ctx context.Context, state FeedState) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.states[feedStateKey(state.Target, state.URL)] = state
+	return nil
+}
+
+// BoltFeedStateStore keeps feed state as JSON in a bucket of a BoltDB file.
+type BoltFeedStateStore struct {
+	store *BoltStore
+}
+
+func OpenBoltFeedStateStore(path string, table string) (*BoltFeedStateStore, error) {
+	store, err := OpenBoltStore(path, table)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltFeedStateStore{store: store}, nil
+}
+
+func (store *BoltFeedStateStore) GetFeedState(ctx context.Context, target string, feedURL string) (FeedState, bool, error) {
+	var state FeedState
+	var found bool
+	err := store.store.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(store.store.bucket).Get([]byte(feedStateKey(target, feedURL)))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &state)
+	})
+	return state, found, err
+}
+
+func (store *BoltFeedStateStore) PutFeedState(ctx context.Context, state FeedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return store.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(store.store.bucket).Put([]byte(feedStateKey(state.Target, state.URL)), data)
+	})
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+)
+
+const (
+	StoreTable  = "table"
+	StoreMemory = "memory"
+	StoreBolt   = "bolt"
+)
+
+// NewsStore persists news items. Items are keyed by NewsKeys, so inserting
+// the same item twice overwrites it.
+type NewsStore interface {
+	Insert(ctx context.Context, item News) error
+	// InsertBatch stores items and returns a *BatchError listing the items
+	// that failed; the other items are stored.
+	InsertBatch(ctx context.Context, items []News) error
+	// Existing reports, for each of items, whether an item with the same
+	// keys is already stored.
+	Existing(ctx context.Context, items []News) ([]bool, error)
+	// Query returns one page of items matching query, ordered by partition
+	// and row key.
+	Query(ctx context.Context, query NewsQuery) (NewsPage, error)
+}
+
+type StoreConfig struct {
+	Backend string // StoreTable (default), StoreMemory or StoreBolt
+	Table   string
+
+	// Table backend. ConnectionString (shared key or SAS, e.g. Azurite)
+	// takes precedence over Endpoint with Credential.
+	Credential       azcore.TokenCredential
+	Endpoint         string
+	ConnectionString string
+	// CreateTable creates Table if it does not exist yet, for emulators
+	// that start empty.
+	CreateTable bool
+
+	// Bolt backend
+	Path string
+}
+
+func OpenStore(config StoreConfig) (NewsStore, error) {
+	switch config.Backend {
+	case "", StoreTable:
+		client, err := OpenTableClient(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewTableStore(client), nil
+	case StoreMemory:
+		return OpenMemoryStore(config.Table), nil
+	case StoreBolt:
+		return OpenBoltStore(config.Path, config.Table)
+	}
+	return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+}
+
+// Table services a table endpoint can belong to.
+const (
+	TableServiceCosmos  = "cosmos"  // Cosmos DB Table API
+	TableServiceStorage = "storage" // Azure Storage Tables
+)
+
+// TableEndpoint returns the public table endpoint of account on service.
+func TableEndpoint(service string, account string) (string, error) {
+	switch service {
+	case "", TableServiceCosmos:
+		return "https://" + account + ".table.cosmos.azure.com", nil
+	case TableServiceStorage:
+		return "https://" + account + ".table.core.windows.net", nil
+	}
+	return "", fmt.Errorf("unknown table service %q", service)
+}
+
+// Tables already created by OpenTableClient, by endpoint and name.
+var (
+	createdTables   = map[string]bool{}
+	createdTablesMu sync.Mutex
+)
+
+// OpenTableClient returns the client of config.Table, creating the table
+// first when config.CreateTable is set.
+func OpenTableClient(config StoreConfig) (*aztables.Client, error) {
+	var client *aztables.Client
+	if config.ConnectionString != "" {
+		service, err := aztables.NewServiceClientFromConnectionString(config.ConnectionString, nil)
+		if err != nil {
+			return nil, err
+		}
+		client = service.NewClient(config.Table)
+	} else {
+		if config.Credential == nil {
+			return nil, fmt.Errorf("table %s: no credential or connection string", config.Table)
+		}
+		client = GetTable(config.Credential, config.Endpoint, config.Table)
+	}
+	if !config.CreateTable {
+		return client, nil
+	}
+
+	createdTablesMu.Lock()
+	defer createdTablesMu.Unlock()
+	key := config.Endpoint + config.ConnectionString + "|" + config.Table
+	if createdTables[key] {
+		return client, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := client.CreateTable(ctx, nil)
+	var responseErr *azcore.ResponseError
+	if err != nil && !(errors.As(err, &responseErr) && responseErr.ErrorCode == string(aztables.TableAlreadyExists)) {
+		return nil, fmt.Errorf("creating table %s: %w", config.Table, err)
+	}
+	createdTables[key] = true
+	return client, nil
+}
+
+// TableStore keeps news in Azure Table storage or the Cosmos DB Table API.
+type TableStore struct {
+	client *aztables.Client
+}
+
+func NewTableStore(client *aztables.Client) *TableStore {
+	return &TableStore{client: client}
+}
+
+func (store *TableStore) Insert(ctx context.Context, item News) error {
+	return InsertData(ctx, store.client, item)
+}
+
+func (store *TableStore) InsertBatch(ctx context.Context, items []News) error {
+	return InsertDataBatch(ctx, store.client, items)
+}
+
+// existingReads is the largest number of entities read at a time by
+// TableStore.Existing.
+const existingReads = 8
+
+// Existing reads each item with its own point read, at most existingReads
+// at a time: a filter with an "or" of row keys scans the whole partition,
+// which holds every item of the feed host.
+func (store *TableStore) Existing(ctx context.Context, items []News) ([]bool, error) {
+	existing := make([]bool, len(items))
+	positions := map[string][]int{}
+	var keys []string
+	for i, item := range items {
+		key := storeKey(NewsKeys(item))
+		if _, ok := positions[key]; !ok {
+			keys = append(keys, key)
+		}
+		positions[key] = append(positions[key], i)
+	}
+
+	found := make([]bool, len(keys))
+	errs := make([]error, len(keys))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(existingReads, len(keys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				partitionKey, rowKey := splitStoreKey(keys[i])
+				_, err := store.client.GetEntity(ctx, partitionKey, rowKey, nil)
+				if isNotFound(err) {
+					continue
+				}
+				found[i], errs[i] = err == nil, err
+			}
+		}()
+	}
+	for i := range keys {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		for _, position := range positions[key] {
+			existing[position] = found[i]
+		}
+	}
+	return existing, nil
+}
+
+// Query reads one page with ListEntities. The category filter is applied to
+// the returned page, so a page may hold fewer items than the limit while
+// still having a continuation token.
+func (store *TableStore) Query(ctx context.Context, query NewsQuery) (NewsPage, error) {
+	options := &aztables.ListEntitiesOptions{
+		Top: to.Ptr(int32(query.limit())),
+	}
+	if filter := query.filter(); filter != "" {
+		options.Filter = to.Ptr(filter)
+	}
+	if query.Continuation != "" {
+		position, err := decodeContinuation(query.Continuation)
+		if err != nil {
+			return NewsPage{}, err
+		}
+		options.NextPartitionKey = to.Ptr(position.PartitionKey)
+		options.NextRowKey = to.Ptr(position.RowKey)
+	}
+
+	response, err := store.client.NewListEntitiesPager(options).NextPage(ctx)
+	if err != nil {
+		return NewsPage{}, err
+	}
+
+	page := NewsPage{Items: []News{}}
+	for _, entity := range response.Entities {
+		item, err := NewsFromEntity(entity)
+		if err != nil {
+			return NewsPage{}, err
+		}
+		if query.Matches(item) {
+			page.Items = append(page.Items, item)
+		}
+	}
+	if response.NextPartitionKey != nil && response.NextRowKey != nil {
+		page.Continuation = encodeContinuation(*response.NextPartitionKey, *response.NextRowKey)
+	}
+	return page, nil
+}
+
+func (err *BatchError) Error() string {
+	messages := make([]string, 0, len(err.Failures))
+	for _, failure := range err.Failures {
+		messages = append(messages, fmt.Sprintf("%q: %v", failure.Item.Title, failure.Err))
+	}
+	return fmt.Sprintf("%d items failed to insert: %s", len(err.Failures), strings.Join(messages, "; "))
+}
+
+func (err *BatchError) add(item News, cause error) {
+	err.Failures = append(err.Failures, InsertFailure{Item: item, Err: cause})
+}
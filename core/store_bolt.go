@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// A bolt file can only be opened once per process, so databases are shared
+// between the stores of different tables.
+var (
+	boltDBs   = map[string]*bolt.DB{}
+	boltDBsMu sync.Mutex
+)
+
+// BoltStore keeps news in a local BoltDB file, one bucket per table.
+type BoltStore struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func OpenBoltStore(path string, table string) (*BoltStore, error) {
+	boltDBsMu.Lock()
+	defer boltDBsMu.Unlock()
+
+	db, ok := boltDBs[path]
+	if !ok {
+		var err error
+		db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		boltDBs[path] = db
+	}
+
+	bucket := []byte(table)
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: db, bucket: bucket}, nil
+}
+
+func (store *BoltStore) Insert(ctx context.Context, item News) error {
+	partitionKey, rowKey := NewsKeys(item)
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(store.bucket).Put([]byte(storeKey(partitionKey, rowKey)), data)
+	})
+}
+
+// InsertBatch writes all items in one bolt transaction.
+func (store *BoltStore) InsertBatch(ctx context.Context, items []News) error {
+	batchErr := &BatchError{}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(store.bucket)
+		for _, item := range items {
+			partitionKey, rowKey := NewsKeys(item)
+			data, err := json.Marshal(item)
+			if err == nil {
+				err = bucket.Put([]byte(storeKey(partitionKey, rowKey)), data)
+			}
+			if err != nil {
+				batchErr.add(item, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(batchErr.Failures) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+func (store *BoltStore) Existing(ctx context.Context, items []News) ([]bool, error) {
+	existing := make([]bool, len(items))
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(store.bucket)
+		for i, item := range items {
+			existing[i] = bucket.Get([]byte(storeKey(NewsKeys(item)))) != nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (store *BoltStore) Query(ctx context.Context, query NewsQuery) (NewsPage, error) {
+	start, err := query.startKey()
+	if err != nil {
+		return NewsPage{}, err
+	}
+
+	page := NewsPage{Items: []News{}}
+	err = store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(store.bucket).Cursor()
+		for key, value := cursor.Seek([]byte(start)); key != nil; key, value = cursor.Next() {
+			item := News{}
+			if err := json.Unmarshal(value, &item); err != nil {
+				return err
+			}
+			if !query.Matches(item) {
+				continue
+			}
+			if len(page.Items) == query.limit() {
+				page.Continuation = encodeContinuation(splitStoreKey(string(key)))
+				break
+			}
+			page.Items = append(page.Items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return NewsPage{}, err
+	}
+	return page, nil
+}
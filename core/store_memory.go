@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+var (
+	memoryStores   = map[string]*MemoryStore{}
+	memoryStoresMu sync.Mutex
+)
+
+// MemoryStore keeps news in process memory. It is meant for local runs and
+// unit tests; everything is lost when the process exits.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	items map[string]News
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]News{}}
+}
+
+// OpenMemoryStore returns the process-wide memory store of table, creating
+// it on first use, so that separate requests see the same data.
+func OpenMemoryStore(table string) *MemoryStore {
+	memoryStoresMu.Lock()
+	defer memoryStoresMu.Unlock()
+
+	store, ok := memoryStores[table]
+	if !ok {
+		store = NewMemoryStore()
+		memoryStores[table] = store
+	}
+	return store
+}
+
+func (store *MemoryStore) Insert(ctx context.Context, item News) error {
+	partitionKey, rowKey := NewsKeys(item)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.items[storeKey(partitionKey, rowKey)] = item
+	return nil
+}
+
+func (store *MemoryStore) InsertBatch(ctx context.Context, items []News) error {
+	for _, item := range items {
+		store.Insert(ctx, item)
+	}
+	return nil
+}
+
+func (store *MemoryStore) Existing(ctx context.Context, items []News) ([]bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	existing := make([]bool, len(items))
+	for i, item := range items {
+		_, existing[i] = store.items[storeKey(NewsKeys(item))]
+	}
+	return existing, nil
+}
+
+func (store *MemoryStore) Query(ctx context.Context, query NewsQuery) (NewsPage, error) {
+	start, err := query.startKey()
+	if err != nil {
+		return NewsPage{}, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	keys := make([]string, 0, len(store.items))
+	for key := range store.items {
+		if key >= start {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	page := NewsPage{Items: []News{}}
+	for _, key := range keys {
+		item := store.items[key]
+		if !query.Matches(item) {
+			continue
+		}
+		if len(page.Items) == query.limit() {
+			page.Continuation = encodeContinuation(splitStoreKey(key))
+			break
+		}
+		page.Items = append(page.Items, item)
+	}
+	return page, nil
+}
@@ -15,8 +15,52 @@ type AtomEntry struct {
 	Description Description `xml:"description"`
 	Date        string      `xml:"pubDate"`
 	Category    []string    `xml:"category"`
-	Enclosure   string      `xml:"enclosure"`
+	Enclosures  []Enclosure `xml:"enclosure"`
 	Id          string      `xml:"guid"`
+	Author      string      `xml:"author"`
+	Creator     string      `xml:"http://purl.org/dc/elements/1.1/ creator"`
+
+	MediaContents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaThumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaGroups     []MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+	ItunesDuration  string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ItunesImage     ItunesImage      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+// Numeric attributes are kept as strings and converted leniently, as an
+// empty or malformed attribute would otherwise fail the whole document.
+
+type Enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// MediaContent is a Media RSS <media:content> (https://www.rssboard.org/media-rss).
+type MediaContent struct {
+	URL        string           `xml:"url,attr"`
+	Type       string           `xml:"type,attr"`
+	Medium     string           `xml:"medium,attr"`
+	FileSize   string           `xml:"fileSize,attr"`
+	Width      string           `xml:"width,attr"`
+	Height     string           `xml:"height,attr"`
+	Duration   string           `xml:"duration,attr"`
+	Thumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type MediaThumbnail struct {
+	URL    string `xml:"url,attr"`
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+}
+
+type MediaGroup struct {
+	Contents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type ItunesImage struct {
+	Href string `xml:"href,attr"`
 }
 
 type Image struct {
@@ -28,14 +72,15 @@ type Image struct {
 }
 
 type AtomChannel struct {
-	Title       string      `xml:"title"`
-	Link        string      `xml:"link"`
-	Description Description `xml:"description"`
-	Date        string      `xml:"pubDate"`
-	Language    string      `xml:"language"`
-	Generator   string      `xml:"generator"`
-	TTL         int32       `xml:"ttl"`
-	Image       Image       `xml:"image"`
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   Description `xml:"description"`
+	Date          string      `xml:"pubDate"`
+	LastBuildDate string      `xml:"lastBuildDate"`
+	Language      string      `xml:"language"`
+	Generator     string      `xml:"generator"`
+	TTL           int32       `xml:"ttl"`
+	Image         Image       `xml:"image"`
 
 	AtomEntries []AtomEntry `xml:"item"`
 }
@@ -45,10 +90,191 @@ type AtomFormat struct {
 	AtomChannel AtomChannel `xml:"channel"`
 }
 
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Data  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+	URI   string `xml:"uri"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// AtomFeedEntry is an Atom 1.0 <entry>. AtomEntry above is an RSS 2.0 <item>.
+type AtomFeedEntry struct {
+	Title      AtomText       `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Id         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+
+	MediaContents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaThumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaGroups     []MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+// AtomFeed is an Atom 1.0 document (RFC 4287). AtomFormat above is RSS 2.0.
+type AtomFeed struct {
+	XMLName  xml.Name        `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    AtomText        `xml:"title"`
+	Subtitle AtomText        `xml:"subtitle"`
+	Links    []AtomLink      `xml:"link"`
+	Id       string          `xml:"id"`
+	Updated  string          `xml:"updated"`
+	Lang     string          `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Entries  []AtomFeedEntry `xml:"entry"`
+}
+
+type RDFItem struct {
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subject     []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+}
+
+type RDFChannel struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Language    string `xml:"http://purl.org/dc/elements/1.1/ language"`
+}
+
+// RDFFormat is an RSS 1.0 document, where the items are siblings of the
+// channel instead of its children.
+type RDFFormat struct {
+	XMLName xml.Name   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# RDF"`
+	Channel RDFChannel `xml:"channel"`
+	Items   []RDFItem  `xml:"item"`
+}
+
+type JSONFeedAuthor struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Avatar string `json:"avatar"`
+}
+
+type JSONFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	Title             string  `json:"title"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+// JSONFeedID is the id of a JSON Feed item. Ids that are numbers, as in
+// many 1.0 feeds, are read as their string form.
+type JSONFeedID string
+
+type JSONFeedItem struct {
+	Id            JSONFeedID           `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	Image         string               `json:"image"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Author        *JSONFeedAuthor      `json:"author"`  // version 1.0
+	Authors       []JSONFeedAuthor     `json:"authors"` // version 1.1
+	Tags          []string             `json:"tags"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+// JSONFeed is a JSON Feed 1.0/1.1 document (https://jsonfeed.org/version/1.1).
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description"`
+	Language    string         `json:"language"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type FeedMetadata struct {
+	Format        string    `json:"format"`
+	Title         string    `json:"title"`
+	Link          string    `json:"link,omitempty"`
+	Language      string    `json:"language,omitempty"`
+	TTL           int       `json:"ttl,omitempty"` // minutes
+	LastBuildDate time.Time `json:"lastBuildDate,omitzero"`
+}
+
+type Feed struct {
+	FeedMetadata
+	Items []News
+}
+
 type News struct {
-	Title       string    `json:"Title"`
-	Date        time.Time `json:"Date"`
-	Description string    `json:"Description"`
+	Id            string    `json:"Id"`
+	Link          string    `json:"Link"`
+	Source        string    `json:"Source"`
+	Channel       string    `json:"Channel"`
+	Title         string    `json:"Title"`
+	Date          time.Time `json:"Date"`
+	DateEstimated bool      `json:"DateEstimated"`
+	// Description is sanitized HTML, DescriptionText its plain text and
+	// WordCount the number of words of it. Image is the first image of the
+	// description, else of Media.
+	Description     string   `json:"Description"`
+	DescriptionText string   `json:"DescriptionText"`
+	WordCount       int      `json:"WordCount"`
+	Image           string   `json:"Image"`
+	Author          string   `json:"Author"`
+	Categories      []string `json:"Categories"`
+	Media           []Media  `json:"Media"`
+}
+
+const (
+	MediaRelEnclosure = "enclosure"
+	MediaRelContent   = "content"
+	MediaRelThumbnail = "thumbnail"
+)
+
+// Media is an enclosure, media:content or media:thumbnail of an item.
+type Media struct {
+	Rel      string  `json:"Rel"` // MediaRelEnclosure, MediaRelContent or MediaRelThumbnail
+	URL      string  `json:"URL"`
+	Type     string  `json:"Type,omitempty"`   // MIME type
+	Medium   string  `json:"Medium,omitempty"` // image, audio, video, document or executable
+	Size     int64   `json:"Size,omitempty"`   // bytes
+	Width    int     `json:"Width,omitempty"`
+	Height   int     `json:"Height,omitempty"`
+	Duration float64 `json:"Duration,omitempty"` // seconds
+}
+
+type InsertFailure struct {
+	Item News
+	Err  error
+}
+
+// BatchError lists the items of a batch insert that were not stored.
+type BatchError struct {
+	Failures []InsertFailure
 }
 
 type responseObjectId struct {
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"azure/core"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Example subscription:
+// POST /api/feeds
+// {
+// "url": "https://dorzeczy.pl/feed",
+// "target": "news",
+// "intervalMinutes": 30
+// }
+// Fields left out of a PUT keep their value.
+type subscriptionRequest struct {
+	Url             *string `json:"url"`
+	Target          *string `json:"target"`
+	IntervalMinutes *int    `json:"intervalMinutes"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+func (request subscriptionRequest) apply(sub *core.Subscription) {
+	if request.Url != nil {
+		sub.URL = *request.Url
+	}
+	if request.Target != nil {
+		sub.Target = *request.Target
+	}
+	if request.IntervalMinutes != nil {
+		sub.IntervalMinutes = *request.IntervalMinutes
+	}
+	if request.Enabled != nil {
+		sub.Enabled = *request.Enabled
+	}
+}
+
+// validateSubscription checks sub and replaces an empty target with the
+// default one.
+func validateSubscription(sub *core.Subscription) *apiError {
+	if apiErr := validateFeedURL(sub.URL); apiErr != nil {
+		return apiErr
+	}
+	alias, _, apiErr := lookupTarget(sub.Target)
+	if apiErr != nil {
+		return apiErr
+	}
+	sub.Target = alias
+	if sub.IntervalMinutes <= 0 {
+		return newAPIError(http.StatusBadRequest, codeInvalidRequest, "intervalMinutes must be positive")
+	}
+	return nil
+}
+
+func readSubscriptionRequest(r *http.Request) (subscriptionRequest, *apiError) {
+	var request subscriptionRequest
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return request, newAPIError(http.StatusBadRequest, codeInvalidRequest, "reading request body: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		return request, newAPIError(http.StatusBadRequest, codeInvalidRequest, "wrong request format: %v", err)
+	}
+	return request, nil
+}
+
+// handleFeeds serves the subscription registry:
+//
+//	GET    /api/feeds       list subscriptions
+//	POST   /api/feeds       add a subscription
+//	GET    /api/feeds/{id}  read one subscription
+//	PUT    /api/feeds/{id}  change url, target, intervalMinutes or enabled
+//	DELETE /api/feeds/{id}  remove a subscription
+func handleFeeds(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	switch {
+	case id == "" && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+	case id != "" && (r.Method == http.MethodGet || r.Method == http.MethodPut || r.Method == http.MethodDelete):
+	default:
+		writeError(w, newAPIError(http.StatusMethodNotAllowed, codeMethodNotAllowed, "method %s is not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+	registry, apiErr := openRegistry()
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	ctx := r.Context()
+
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			subs, err := registry.ListSubscriptions(ctx)
+			if err != nil {
+				writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+				return
+			}
+			if subs == nil {
+				subs = []core.Subscription{}
+			}
+			writeJSON(w, http.StatusOK, map[string][]core.Subscription{"feeds": subs})
+		case http.MethodPost:
+			request, apiErr := readSubscriptionRequest(r)
+			if apiErr != nil {
+				writeError(w, apiErr)
+				return
+			}
+			sub := core.Subscription{IntervalMinutes: core.DefaultIntervalMinutes, Enabled: true}
+			request.apply(&sub)
+			if apiErr := validateSubscription(&sub); apiErr != nil {
+				writeError(w, apiErr)
+				return
+			}
+			sub.ID = core.SubscriptionID(sub.URL, sub.Target)
+			if _, found, err := registry.GetSubscription(ctx, sub.ID); err != nil {
+				writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+				return
+			} else if found {
+				writeError(w, newAPIError(http.StatusConflict, codeFeedExists, "feed %s is already registered for target %s as %s", sub.URL, sub.Target, sub.ID))
+				return
+			}
+			if err := registry.PutSubscription(ctx, sub); err != nil {
+				writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+				return
+			}
+			writeJSON(w, http.StatusCreated, sub)
+		}
+		return
+	}
+
+	sub, found, err := registry.GetSubscription(ctx, id)
+	if err != nil {
+		writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+		return
+	}
+	if !found {
+		writeError(w, newAPIError(http.StatusNotFound, codeFeedNotFound, "feed %s is not registered", id))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, sub)
+	case http.MethodPut:
+		request, apiErr := readSubscriptionRequest(r)
+		if apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		request.apply(&sub)
+		if apiErr := validateSubscription(&sub); apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		// The id derives from url and target: a subscription whose url or
+		// target changes moves to its new id, unless that one is taken.
+		sub.ID = core.SubscriptionID(sub.URL, sub.Target)
+		if sub.ID != id {
+			if _, found, err := registry.GetSubscription(ctx, sub.ID); err != nil {
+				writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+				return
+			} else if found {
+				writeError(w, newAPIError(http.StatusConflict, codeFeedExists, "feed %s is already registered for target %s as %s", sub.URL, sub.Target, sub.ID))
+				return
+			}
+		}
+		if err := registry.PutSubscription(ctx, sub); err != nil {
+			writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+			return
+		}
+		if sub.ID != id {
+			if err := registry.DeleteSubscription(ctx, id); err != nil {
+				writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, sub)
+	case http.MethodDelete:
+		if err := registry.DeleteSubscription(ctx, id); err != nil {
+			writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ingestDue ingests every due subscription of the registry. It serves a POST
+// without body.
+func ingestDue(w http.ResponseWriter, r *http.Request) {
+	results, apiErr := dueResults(r.Context())
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]feedResult{"results": results})
+}
+
+func dueResults(ctx context.Context) ([]feedResult, *apiError) {
+	registry, apiErr := openRegistry()
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	targets := func(target string) (core.IngestTarget, error) {
+		ingestTarget, apiErr := openIngestTarget(target)
+		if apiErr != nil {
+			return ingestTarget, apiErr
+		}
+		return ingestTarget, nil
+	}
+
+	due, err := core.IngestDue(ctx, feedClient(), registry, targets, workers, feedTimeout)
+	if err != nil {
+		return nil, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err)
+	}
+	results := make([]feedResult, len(due))
+	for i, result := range due {
+		results[i] = feedResult{IngestReport: result.Report, ID: result.Subscription.ID, Target: result.Subscription.Target}
+		logWarnings(result.Report)
+		if result.Err != nil {
+			results[i].Error = ingestAPIError(result.Err)
+			log.Printf("%s: %v\n", result.Subscription.URL, results[i].Error)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// invocationRequest is the payload the Functions host posts to
+// /{function name} when a request is not forwarded as plain HTTP. Data holds
+// one entry per input binding, keyed by binding name, e.g. for TimerTrigger1:
+// {"Data": {"timer": {"Schedule": {...}, "IsPastDue": false}}, "Metadata": {...}}
+type invocationRequest struct {
+	Data     map[string]json.RawMessage `json:"Data"`
+	Metadata map[string]json.RawMessage `json:"Metadata"`
+}
+
+// invocationResponse is returned to the host. Outputs holds one value per
+// output binding; Logs appear in the host log stream; ReturnValue feeds a
+// binding named "$return".
+type invocationResponse struct {
+	Outputs     map[string]any `json:"Outputs"`
+	Logs        []string       `json:"Logs"`
+	ReturnValue any            `json:"ReturnValue"`
+}
+
+// invocation is one call of a function: its request and the response being
+// built.
+type invocation struct {
+	invocationRequest
+	invocationResponse
+}
+
+// Logf writes to the server log and to the invocation logs.
+func (inv *invocation) Logf(format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	log.Println(line)
+	inv.Logs = append(inv.Logs, line)
+}
+
+// Bind decodes the input binding name into value.
+func (inv *invocation) Bind(name string, value any) error {
+	raw, ok := inv.Data[name]
+	if !ok {
+		return fmt.Errorf("missing input binding %q", name)
+	}
+	return json.Unmarshal(raw, value)
+}
+
+// functionHandler runs one invocation. A returned error fails the
+// invocation; the logs gathered so far are still sent.
+type functionHandler func(ctx context.Context, inv *invocation) error
+
+// handleInvocation routes an invocation to the handler of the function named
+// by the path.
+func handleInvocation(functions map[string]functionHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("function")
+		handler, ok := functions[name]
+		if !ok {
+			writeError(w, newAPIError(http.StatusNotFound, codeFunctionNotFound, "function %q is not handled", name))
+			return
+		}
+
+		inv := &invocation{invocationResponse: invocationResponse{Outputs: map[string]any{}, Logs: []string{}}}
+		data, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(data, &inv.invocationRequest)
+		}
+		if err != nil {
+			writeError(w, newAPIError(http.StatusBadRequest, codeInvalidRequest, "wrong invocation format: %v", err))
+			return
+		}
+
+		status := http.StatusOK
+		if err := handler(r.Context(), inv); err != nil {
+			inv.Logf("%s failed: %v", name, err)
+			status = http.StatusInternalServerError
+			var apiErr *apiError
+			if errors.As(err, &apiErr) {
+				status = apiErr.Status
+			}
+		}
+		writeJSON(w, status, inv.invocationResponse)
+	}
+}
+
+// httpTriggerRequest is the "req" input of an HTTP trigger.
+type httpTriggerRequest struct {
+	Url     string              `json:"Url"`
+	Method  string              `json:"Method"`
+	Headers map[string][]string `json:"Headers"`
+	Body    json.RawMessage     `json:"Body"`
+}
+
+// body returns the request body. The host sends a text body as a JSON
+// string and a JSON body as is.
+func (trigger httpTriggerRequest) body() string {
+	var text string
+	if json.Unmarshal(trigger.Body, &text) == nil {
+		return text
+	}
+	return string(trigger.Body)
+}
+
+// httpTriggerResponse is the "res" output of an HTTP trigger.
+type httpTriggerResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// httpFunction adapts handler to HTTP trigger invocations, so the same
+// handlers serve forwarded requests and invocation envelopes.
+func httpFunction(handler http.Handler) functionHandler {
+	return func(ctx context.Context, inv *invocation) error {
+		var trigger httpTriggerRequest
+		if err := inv.Bind("req", &trigger); err != nil {
+			return newAPIError(http.StatusBadRequest, codeInvalidRequest, "%v", err)
+		}
+		request, err := http.NewRequestWithContext(ctx, trigger.Method, trigger.Url, strings.NewReader(trigger.body()))
+		if err != nil {
+			return newAPIError(http.StatusBadRequest, codeInvalidRequest, "%v", err)
+		}
+		for key, values := range trigger.Headers {
+			for _, value := range values {
+				request.Header.Add(key, value)
+			}
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		response := httpTriggerResponse{
+			StatusCode: recorder.Code,
+			Headers:    map[string]string{},
+			Body:       recorder.Body.String(),
+		}
+		for key := range recorder.Header() {
+			response.Headers[key] = recorder.Header().Get(key)
+		}
+		inv.Outputs["res"] = response
+		return nil
+	}
+}
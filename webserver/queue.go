@@ -0,0 +1,207 @@
+package main
+
+import (
+	"azure/core"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the queue bindings in EnqueueFeeds, TimerTrigger1 and
+// QueueTrigger1.
+const (
+	queueOutput  = "feeds"
+	poisonOutput = "poison"
+	messageInput = "message"
+)
+
+// poisonMessage is written to the poison queue for a feed that cannot be
+// ingested.
+type poisonMessage struct {
+	Message      json.RawMessage `json:"message"`
+	Error        *apiError       `json:"error"`
+	DequeueCount int             `json:"dequeueCount"`
+}
+
+// ingestMessages returns one queue message per feed of postRequest, or per
+// due registered feed when postRequest has no feeds.
+func ingestMessages(ctx context.Context, postRequest POSTRequest) ([]core.IngestMessage, *apiError) {
+	var messages []core.IngestMessage
+	if postRequest.Url == "" && len(postRequest.Feeds) == 0 {
+		registry, apiErr := openRegistry()
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		due, err := core.ClaimDue(ctx, registry, time.Now())
+		for _, sub := range due {
+			messages = append(messages, core.IngestMessage{URL: sub.URL, Target: sub.Target, SubscriptionID: sub.ID})
+		}
+		if err != nil {
+			return messages, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err)
+		}
+		return messages, nil
+	}
+
+	feeds := postRequest.Feeds
+	if postRequest.Url != "" {
+		feeds = append([]FeedRequest{{Url: postRequest.Url}}, feeds...)
+	}
+	for _, feed := range feeds {
+		if apiErr := validateFeedURL(feed.Url); apiErr != nil {
+			return nil, apiErr
+		}
+		if feed.Target == "" {
+			feed.Target = postRequest.Target
+		}
+		alias, _, apiErr := lookupTarget(feed.Target)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		messages = append(messages, core.IngestMessage{URL: feed.Url, Target: alias})
+	}
+	return messages, nil
+}
+
+// runEnqueue handles EnqueueFeeds: a POST with the body of an ingestion
+// request queues one message per feed instead of ingesting them, and an
+// empty body queues the due registered feeds.
+func runEnqueue(ctx context.Context, inv *invocation) error {
+	var trigger httpTriggerRequest
+	if err := inv.Bind("req", &trigger); err != nil {
+		return newAPIError(http.StatusBadRequest, codeInvalidRequest, "%v", err)
+	}
+	var postRequest POSTRequest
+	if body := trigger.body(); strings.TrimSpace(body) != "" {
+		if err := decodeRequest([]byte(body), &postRequest); err != nil {
+			inv.Outputs["res"] = httpErrorResponse(newAPIError(http.StatusBadRequest, codeInvalidRequest, "wrong request format: %v", err))
+			return nil
+		}
+	}
+
+	messages, apiErr := ingestMessages(ctx, postRequest)
+	if len(messages) > 0 {
+		inv.Outputs[queueOutput] = messages
+	}
+	if apiErr != nil {
+		inv.Outputs["res"] = httpErrorResponse(apiErr)
+		return nil
+	}
+	inv.Logf("queued %d feeds", len(messages))
+	inv.Outputs["res"] = httpJSONResponse(http.StatusAccepted, map[string]any{"queued": len(messages), "messages": messages})
+	return nil
+}
+
+// runQueue handles QueueTrigger1: it ingests the feed of one message.
+// Failures that may be temporary fail the invocation, so the host retries
+// the message and moves it to the poison queue after maxDequeueCount
+// attempts (host.json); permanent failures go to the poison queue at once.
+func runQueue(ctx context.Context, inv *invocation) error {
+	raw := inv.Data[messageInput]
+	dequeueCount := inv.dequeueCount()
+	poison := func(apiErr *apiError) error {
+		inv.Logf("moving %s to %s: %v", raw, core.IngestPoisonQueue, apiErr)
+		inv.Outputs[poisonOutput] = poisonMessage{Message: raw, Error: apiErr, DequeueCount: dequeueCount}
+		return nil
+	}
+
+	var message core.IngestMessage
+	if err := unmarshalString(raw, &message); err != nil {
+		return poison(newAPIError(http.StatusBadRequest, codeInvalidRequest, "wrong message format: %v", err))
+	}
+	if apiErr := validateFeedURL(message.URL); apiErr != nil {
+		return poison(apiErr)
+	}
+
+	alias, _, apiErr := lookupTarget(message.Target)
+	if apiErr != nil && apiErr.Code == codeUnknownTarget {
+		return poison(apiErr)
+	}
+	if apiErr != nil {
+		// An unreadable targets file is not the message's fault and may be
+		// fixed before the host gives up on it.
+		return apiErr
+	}
+	target, apiErr := openIngestTarget(alias)
+	if apiErr != nil {
+		return apiErr
+	}
+	target.URL = message.URL
+	ingestCtx, cancel := context.WithTimeout(ctx, feedTimeout)
+	defer cancel()
+	report, err := core.IngestFeed(ingestCtx, feedClient(), target)
+	logWarnings(report)
+
+	if message.SubscriptionID != "" {
+		recordSubscription(ctx, inv, message, err)
+	}
+	if err != nil {
+		apiErr := ingestAPIError(err)
+		if !core.Retryable(err) {
+			return poison(apiErr)
+		}
+		inv.Logf("%s: attempt %d failed: %v", message.URL, dequeueCount, apiErr)
+		return apiErr
+	}
+	inv.Logf("%s: %s", message.URL, summary(report))
+	inv.ReturnValue = report
+	return nil
+}
+
+// recordSubscription saves the outcome of a registered feed's ingestion.
+func recordSubscription(ctx context.Context, inv *invocation, message core.IngestMessage, err error) {
+	registry, apiErr := openRegistry()
+	if apiErr != nil {
+		inv.Logf("recording %s: %v", message.SubscriptionID, apiErr)
+		return
+	}
+	sub, found, getErr := registry.GetSubscription(ctx, message.SubscriptionID)
+	if getErr != nil || !found {
+		inv.Logf("recording %s: not found %v", message.SubscriptionID, getErr)
+		return
+	}
+	sub.Record(time.Now(), err)
+	if err := registry.PutSubscription(ctx, sub); err != nil {
+		inv.Logf("recording %s: %v", message.SubscriptionID, err)
+	}
+}
+
+// dequeueCount returns how many times the triggering message was dequeued,
+// including this time; the host sends it as a number or a string.
+func (inv *invocation) dequeueCount() int {
+	var count json.Number
+	if err := unmarshalString(inv.Metadata["DequeueCount"], &count); err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(count.String())
+	return n
+}
+
+// unmarshalString decodes data into value; data may also be a JSON string
+// holding the JSON document, as the host sends queue messages.
+func unmarshalString(data json.RawMessage, value any) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		data = json.RawMessage(text)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("empty value")
+	}
+	return json.Unmarshal(data, value)
+}
+
+func httpJSONResponse(status int, body any) httpTriggerResponse {
+	data, _ := json.Marshal(body)
+	return httpTriggerResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(data),
+	}
+}
+
+func httpErrorResponse(err *apiError) httpTriggerResponse {
+	return httpJSONResponse(err.Status, map[string]*apiError{"error": err})
+}
@@ -6,38 +6,104 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+)
+
+const (
+	ingestModeDirect = "direct"
+	ingestModeQueue  = "queue"
+)
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+// Values of AZURE_CREDENTIAL and of a target's "auth": how the table backend
+// authenticates.
+const (
+	credentialSecret           = "secret"           // AZURE_TENANT_ID, AZURE_ACCOUNT, AZURE_SECRET
+	credentialDefault          = "default"          // managed identity, environment or az login
+	credentialConnectionString = "connectionstring" // TABLE_CONNECTION_STRING, e.g. Azurite
 )
 
 var (
-	tenantid string
-	account  string
-	secret   string
+	tenantid       string
+	account        string
+	secret         string
+	storeBackend   = core.StoreTable
+	storePath      = "news.db"
+	workers        = core.DefaultIngestWorkers
+	feedTimeout    = core.DefaultFeedTimeout
+	feedStateTable = core.FeedStateTable
+	feedsTable     = core.FeedsTable
+	dedupTable     = core.DedupTable // empty disables duplicate detection
+	ingestMode     = ingestModeDirect
+	// Restrictions on the feed urls fetched, see feedClient.
+	fetchPolicy = core.DefaultFetchPolicy()
+	// Table backend of the "default" target, used when there is no
+	// targets file.
+	credentialType        = credentialSecret
+	tableService          = core.TableServiceCosmos
+	tableEndpoint         string
+	tableConnectionString string
+	tableCreate           bool
+	storeAccount          string
+	// Used by scheduled runs.
+	storeTable     string
+	scheduledFeeds []string
 )
 
-// Example request:
+// Example request, "target" names a storage target of targets.json and
+// defaults to the server's default target:
 // {
 // "url": "https://dorzeczy.pl/feed",
-// "account": "myaccount1234jb",
-// "table": "mytable123"
+// "target": "news"
+// }
+// Several feeds can be sent at once in "feeds"; a feed without its own
+// "target" goes to the request's target:
+// {
+// "target": "news",
+// "feeds": [{"url": "https://dorzeczy.pl/feed"}, {"url": "https://www.rp.pl/rss_main", "target": "archive"}]
 // }
 type POSTRequest struct {
-	Url     string `json:"url"`
-	Account string `json:"account"`
-	Table   string `json:"table"`
+	Url    string        `json:"url"`
+	Target string        `json:"target"`
+	Feeds  []FeedRequest `json:"feeds"`
+}
+
+type FeedRequest struct {
+	Url    string `json:"url"`
+	Target string `json:"target"`
+}
+
+// decodeRequest decodes an ingestion request. Unknown fields, such as the
+// "account" and "table" of older clients, are rejected rather than ignored.
+func decodeRequest(data []byte, postRequest *POSTRequest) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(postRequest)
+}
+
+// feedResult is the outcome of one feed of a multi-feed request. ID is set
+// for registered feeds.
+type feedResult struct {
+	core.IngestReport
+	ID     string    `json:"id,omitempty"`
+	Target string    `json:"target"`
+	Error  *apiError `json:"error,omitempty"`
 }
 
 func ImportEnv(filename string) {
 	filePtr, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -45,8 +111,16 @@ func ImportEnv(filename string) {
 
 	scanner := bufio.NewScanner(filePtr)
 	for scanner.Scan() {
-		envVar := strings.Split(scanner.Text(), "=")
-		key, value := envVar[0], envVar[1]
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Values such as connection strings contain '=' themselves.
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
 		value = strings.TrimPrefix(value, "\"")
 		value = strings.TrimSuffix(value, "\"")
 
@@ -57,6 +131,70 @@ func ImportEnv(filename string) {
 			account = value
 		case "AZURE_SECRET":
 			secret = value
+		case "AZURE_CREDENTIAL":
+			credentialType = value
+		case "TABLE_SERVICE":
+			tableService = value
+		case "TABLE_ENDPOINT":
+			tableEndpoint = value
+		case "TABLE_CONNECTION_STRING":
+			tableConnectionString = value
+		case "TABLE_CREATE":
+			tableCreate = value == "true"
+		case "STORE_BACKEND":
+			storeBackend = value
+		case "STORE_PATH":
+			storePath = value
+		case "INGEST_MODE":
+			ingestMode = value
+		case "STORE_ACCOUNT":
+			storeAccount = value
+		case "STORE_TABLE":
+			storeTable = value
+		case "STORE_TARGETS":
+			targetsPath = value
+		case "STORE_TARGET":
+			defaultTarget = value
+		case "SCHEDULED_FEEDS":
+			scheduledFeeds = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		case "FEEDS_TABLE":
+			feedsTable = value
+		case "FEED_STATE_TABLE":
+			feedStateTable = value
+		case "DEDUP_TABLE":
+			dedupTable = value
+		case "FETCH_ALLOW_PRIVATE":
+			fetchPolicy.AllowPrivate = value == "true"
+		case "FETCH_ALLOW_HOSTS":
+			fetchPolicy.AllowHosts = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		case "FETCH_DENY_HOSTS":
+			fetchPolicy.DenyHosts = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		case "FETCH_MAX_REDIRECTS":
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				fetchPolicy.MaxRedirects = n
+			}
+		case "FETCH_MAX_BYTES":
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+				fetchPolicy.MaxBodyBytes = n
+			}
+		case "FETCH_USER_AGENT":
+			fetchPolicy.UserAgent = value
+		case "FETCH_ATTEMPTS":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				fetchPolicy.Retry.MaxAttempts = n
+			}
+		case "FETCH_HOST_CONCURRENCY":
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				fetchPolicy.HostConcurrency = n
+			}
+		case "INGEST_WORKERS":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				workers = n
+			}
+		case "INGEST_TIMEOUT":
+			if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+				feedTimeout = timeout
+			}
 		}
 	}
 
@@ -65,74 +203,279 @@ func ImportEnv(filename string) {
 	}
 }
 
-func handleRequest(w http.ResponseWriter, r *http.Request) {
+// apiError is the JSON error body returned by the webserver. Code is
+// stable and meant for programs; Message is for people.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeInvalidFeedURL   = "invalid_feed_url"
+	codeFetchFailed      = "fetch_failed"
+	codeFeedHTTPError    = "feed_http_error"
+	codeFeedInvalid      = "feed_invalid"
+	codeFeedURLBlocked   = "feed_url_blocked"
+	codeFeedTooLarge     = "feed_too_large"
+	codeCredentialFailed = "credential_failed"
+	codeStoreUnavailable = "store_unavailable"
+	codeStoreFailed      = "store_failed"
+	codeFeedNotFound     = "feed_not_found"
+	codeFeedExists       = "feed_exists"
+	codeFunctionNotFound = "function_not_found"
+	codeUnknownTarget    = "unknown_target"
+	codeInternal         = "internal_error"
+)
+
+func (err *apiError) Error() string {
+	return err.Code + ": " + err.Message
+}
+
+func newAPIError(status int, code string, format string, args ...any) *apiError {
+	return &apiError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
 	w.Header().Set("Content-Type", "application/json")
-	if r.Method == "GET" {
-		w.Write([]byte("hello world"))
-	} else if r.Method == "POST" {
-		var buf bytes.Buffer
-		var postRequest POSTRequest
-		buflog := log.New(&buf, "[buf:]", log.LstdFlags)
-
-		if r.Body == nil {
-			buflog.Printf("Body is nil")
-			w.Write([]byte("Body is nil"))
-		}
-		data, err := io.ReadAll(r.Body)
-		if err != nil {
-			buflog.Printf("Error during reading of request body: %v\n", err)
-			w.Write(buf.Bytes())
-		}
-		err = json.Unmarshal(data, &postRequest)
-		if err != nil {
-			buflog.Printf("Wrong request format: %v\n", err)
-			w.Write(buf.Bytes())
-		}
-		w.Write([]byte(postRequest.Url + " " + postRequest.Table + " " + postRequest.Account))
-
-		feedURL := postRequest.Url
-		resp, err := http.Get(feedURL)
-		if err != nil {
-			buflog.Printf("Fail to fetch data: %v\n", err)
-			w.Write(buf.Bytes())
-		}
-		defer resp.Body.Close()
-
-		feed := core.AtomFormat{}
-		decoder := xml.NewDecoder(resp.Body)
-		err = decoder.Decode(&feed)
-		if err != nil {
-			buflog.Printf("Error during paring: %v\n", err)
-			w.Write(buf.Bytes())
-		}
-
-		ImportEnv("./.env")
-		context := context.Background()
-		credentials, err := azidentity.NewClientSecretCredential(tenantid, account, secret, nil)
-		if err != nil {
-			buflog.Println(err)
-			w.Write(buf.Bytes())
-		}
-
-		items := feed.AtomChannel.AtomEntries
-		tableClient := core.GetTable(credentials, "https://"+postRequest.Account+".table.cosmos.azure.com", postRequest.Table)
-		for _, item := range items {
-			time, err := time.Parse(time.RFC1123Z, item.Date)
-			if err != nil {
-				buflog.Printf("Problem with parsing: %v\n", err)
-				w.Write(buf.Bytes())
-			}
-			err = core.InsertData(context, tableClient, core.News{
-				Title:       item.Title,
-				Date:        time,
-				Description: item.Description.Data,
-			})
-			if err != nil {
-				buflog.Printf("Failed to insert: %v\n", err)
-				w.Write(buf.Bytes())
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	log.Printf("%d %v\n", err.Status, err)
+	writeJSON(w, err.Status, map[string]*apiError{"error": err})
+}
+
+// Example query:
+// GET /api/HttpTrigger1?target=news&feed=https://dorzeczy.pl/feed&from=2025-06-01&category=Polska&limit=20
+// Pass the returned "continuation" value as &continuation=... to read the next page.
+func parseQuery(values url.Values) (core.NewsQuery, error) {
+	query := core.NewsQuery{
+		Feed:         values.Get("feed"),
+		Category:     values.Get("category"),
+		Continuation: values.Get("continuation"),
+	}
+	var err error
+	if from := values.Get("from"); from != "" {
+		if query.From, _, err = core.ParseDate(from); err != nil {
+			return query, fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if to := values.Get("to"); to != "" {
+		if query.To, _, err = core.ParseDate(to); err != nil {
+			return query, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("invalid limit: %q", limit)
+		}
+	}
+	return query, nil
+}
+
+func handleQuery(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	query, err := parseQuery(values)
+	if err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, codeInvalidRequest, "%v", err))
+		return
+	}
+	for _, key := range []string{"account", "table"} {
+		if values.Has(key) {
+			writeError(w, newAPIError(http.StatusBadRequest, codeInvalidRequest, "%s is not accepted, name a target instead", key))
+			return
+		}
+	}
+	store, apiErr := openStore(values.Get("target"))
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	page, err := store.Query(r.Context(), query)
+	if errors.Is(err, core.ErrInvalidContinuation) {
+		writeError(w, newAPIError(http.StatusBadRequest, codeInvalidRequest, "%v", err))
+		return
+	}
+	if err != nil {
+		writeError(w, newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleIngest ingests the feeds of the request, or all due registered
+// feeds when the body is empty.
+func handleIngest(w http.ResponseWriter, r *http.Request) {
+	var postRequest POSTRequest
+	if r.Body == nil {
+		ingestDue(w, r)
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, codeInvalidRequest, "reading request body: %v", err))
+		return
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		ingestDue(w, r)
+		return
+	}
+	if err := decodeRequest(data, &postRequest); err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, codeInvalidRequest, "wrong request format: %v", err))
+		return
+	}
+
+	if len(postRequest.Feeds) == 0 {
+		report, apiErr := ingest(r.Context(), postRequest)
+		if apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]feedResult{"results": ingestMany(r.Context(), postRequest)})
+}
+
+func validateFeedURL(rawURL string) *apiError {
+	feedURL, err := url.Parse(rawURL)
+	if err != nil || (feedURL.Scheme != "http" && feedURL.Scheme != "https") || feedURL.Host == "" {
+		return newAPIError(http.StatusBadRequest, codeInvalidFeedURL, "feed url must be an absolute http(s) url: %q", rawURL)
+	}
+	if err := fetchPolicy.CheckURL(feedURL); err != nil {
+		return newAPIError(http.StatusBadRequest, codeFeedURLBlocked, "%v", err)
+	}
+	return nil
+}
+
+// feedClient returns the client feeds are fetched with. It enforces
+// fetchPolicy: no internal addresses, FETCH_MAX_REDIRECTS redirects,
+// FETCH_MAX_BYTES per document, INGEST_TIMEOUT per fetch, retries and
+// FETCH_HOST_CONCURRENCY requests per host. The client is shared by all
+// requests, so that the limit per host holds across them.
+var feedClient = sync.OnceValue(func() *http.Client {
+	policy := fetchPolicy
+	policy.Timeout = feedTimeout
+	return core.NewFetchClient(policy)
+})
+
+func ingest(ctx context.Context, postRequest POSTRequest) (core.IngestReport, *apiError) {
+	if apiErr := validateFeedURL(postRequest.Url); apiErr != nil {
+		return core.IngestReport{}, apiErr
+	}
+	target, apiErr := openIngestTarget(postRequest.Target)
+	if apiErr != nil {
+		return core.IngestReport{}, apiErr
+	}
+	target.URL = postRequest.Url
+
+	ctx, cancel := context.WithTimeout(ctx, feedTimeout)
+	defer cancel()
+	report, err := core.IngestFeed(ctx, feedClient(), target)
+	logWarnings(report)
+	if err != nil {
+		return report, ingestAPIError(err)
+	}
+	return report, nil
+}
+
+// ingestMany ingests every feed of postRequest concurrently. Feeds that
+// cannot be started, because of a bad url or store, get their error
+// without being fetched.
+func ingestMany(ctx context.Context, postRequest POSTRequest) []feedResult {
+	feeds := postRequest.Feeds
+	if postRequest.Url != "" {
+		feeds = append([]FeedRequest{{Url: postRequest.Url}}, feeds...)
+	}
+
+	results := make([]feedResult, len(feeds))
+	opened := map[string]core.IngestTarget{}
+	var targets []core.IngestTarget
+	var indexes []int
+	for i, feed := range feeds {
+		if feed.Target == "" {
+			feed.Target = postRequest.Target
+		}
+		alias, _, apiErr := lookupTarget(feed.Target)
+		results[i] = feedResult{IngestReport: core.IngestReport{URL: feed.Url}, Target: alias}
+		if apiErr == nil {
+			apiErr = validateFeedURL(feed.Url)
+		}
+		if apiErr != nil {
+			results[i].Error = apiErr
+			continue
+		}
+		target, ok := opened[alias]
+		if !ok {
+			if target, apiErr = openIngestTarget(alias); apiErr != nil {
+				results[i].Error = apiErr
+				continue
 			}
+			opened[alias] = target
+		}
+		target.URL = feed.Url
+		targets = append(targets, target)
+		indexes = append(indexes, i)
+	}
+
+	for j, result := range core.IngestFeeds(ctx, feedClient(), targets, workers, feedTimeout) {
+		i := indexes[j]
+		results[i].IngestReport = result.Report
+		logWarnings(result.Report)
+		if result.Err != nil {
+			results[i].Error = ingestAPIError(result.Err)
+			log.Printf("%s: %v\n", feeds[i].Url, results[i].Error)
+		}
+	}
+	return results
+}
+
+func logWarnings(report core.IngestReport) {
+	for _, warning := range report.Warnings {
+		log.Printf("%s: %s: %s\n", report.URL, warning.Title, warning.Reason)
+	}
+}
+
+// ingestAPIError maps a failed ingestion to the error returned to the caller.
+func ingestAPIError(err error) *apiError {
+	var ingestErr *core.IngestError
+	if !errors.As(err, &ingestErr) {
+		return newAPIError(http.StatusInternalServerError, codeInternal, "%v", err)
+	}
+	switch ingestErr.Stage {
+	case core.StageFetch:
+		var policyErr *core.PolicyError
+		if errors.As(err, &policyErr) {
+			return newAPIError(http.StatusBadRequest, codeFeedURLBlocked, "%v", policyErr)
+		}
+		var sizeErr *core.BodyTooLargeError
+		if errors.As(err, &sizeErr) {
+			return newAPIError(http.StatusBadGateway, codeFeedTooLarge, "%v", sizeErr)
+		}
+		var statusErr *core.HTTPStatusError
+		if errors.As(err, &statusErr) {
+			return newAPIError(http.StatusBadGateway, codeFeedHTTPError, "%v", ingestErr.Err)
 		}
-		w.Write([]byte("Succeed!!!"))
+		return newAPIError(http.StatusBadGateway, codeFetchFailed, "fetching feed: %v", ingestErr.Err)
+	case core.StageParse:
+		return newAPIError(http.StatusBadGateway, codeFeedInvalid, "parsing feed: %v", ingestErr.Err)
+	default:
+		return newAPIError(http.StatusServiceUnavailable, codeStoreFailed, "%v", ingestErr.Err)
+	}
+}
+
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleQuery(w, r)
+	case http.MethodPost:
+		handleIngest(w, r)
+	default:
+		writeError(w, newAPIError(http.StatusMethodNotAllowed, codeMethodNotAllowed, "method %s is not allowed", r.Method))
 	}
 }
 
@@ -142,8 +485,25 @@ func main() {
 		fmt.Println("Variable: FUNCTIONS_CUSTOMHANDLER_PORT not exists!")
 		customHandlerPort = "8080"
 	}
+	// Configuration is read once: handlers only read it, concurrently.
+	ImportEnv("./.env")
+	loadTargets()
+	if _, _, apiErr := lookupTarget(""); apiErr != nil {
+		log.Printf("%s; the feed registry is unavailable\n", apiErr.Message)
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", handleRequest)
+	mux.HandleFunc("/api/feeds", handleFeeds)
+	mux.HandleFunc("/api/feeds/{id}", handleFeeds)
+	// Invocations of functions not forwarded as plain HTTP, see host.json.
+	mux.HandleFunc("POST /{function}", handleInvocation(map[string]functionHandler{
+		"HttpTrigger1":  httpFunction(mux),
+		"Feeds":         httpFunction(mux),
+		"TimerTrigger1": runTimer,
+		"EnqueueFeeds":  runEnqueue,
+		"QueueTrigger1": runQueue,
+	}))
 	fmt.Println("Go server Listening on: ", customHandlerPort)
 	err := http.ListenAndServe(":"+customHandlerPort, mux)
 	if err != nil {
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"azure/core"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// storageTarget is a destination of news configured on the server. Requests
+// name a target by its alias and never choose endpoints or credentials.
+//
+// Example targets.json:
+//
+//	{
+//	  "news": {"service": "cosmos", "account": "myaccount1234jb", "table": "mytable123"},
+//	  "archive": {"service": "storage", "account": "mystorage1234", "table": "archive", "auth": "default"},
+//	  "local": {"table": "news", "auth": "connectionstring", "connectionString": "...", "createTable": true}
+//	}
+type storageTarget struct {
+	// Service is core.TableServiceCosmos (default) or
+	// core.TableServiceStorage; with Account it gives the endpoint unless
+	// Endpoint is set.
+	Service  string `json:"service"`
+	Account  string `json:"account"`
+	Endpoint string `json:"endpoint"`
+	Table    string `json:"table"`
+	// Auth is credentialSecret (default), credentialDefault or
+	// credentialConnectionString.
+	Auth             string `json:"auth"`
+	ConnectionString string `json:"connectionString"`
+	CreateTable      bool   `json:"createTable"`
+}
+
+// defaultTargetAlias names the target built from .env when there is no
+// targets file.
+const defaultTargetAlias = "default"
+
+var (
+	targetsPath   = "./targets.json"
+	defaultTarget string
+	targets       map[string]storageTarget
+	targetsErr    error
+)
+
+// loadTargets reads the targets file, once at startup after ImportEnv.
+// Without one, a single target named "default" is built from the STORE_*
+// and TABLE_* settings of .env.
+func loadTargets() {
+	data, err := os.ReadFile(targetsPath)
+	if os.IsNotExist(err) {
+		targets = map[string]storageTarget{defaultTargetAlias: {
+			Service:          tableService,
+			Account:          storeAccount,
+			Endpoint:         tableEndpoint,
+			Table:            storeTable,
+			Auth:             credentialType,
+			ConnectionString: tableConnectionString,
+			CreateTable:      tableCreate,
+		}}
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &targets)
+	}
+	if err != nil {
+		targetsErr = fmt.Errorf("reading %s: %w", targetsPath, err)
+	}
+}
+
+// lookupTarget returns the target named alias, or the default target
+// (STORE_TARGET, or the only target) when alias is empty.
+func lookupTarget(alias string) (string, storageTarget, *apiError) {
+	if targetsErr != nil {
+		return "", storageTarget{}, newAPIError(http.StatusInternalServerError, codeStoreUnavailable, "%v", targetsErr)
+	}
+	if alias == "" {
+		alias = defaultTarget
+	}
+	if alias == "" && len(targets) == 1 {
+		for only := range targets {
+			alias = only
+		}
+	}
+	if alias == "" {
+		if _, ok := targets[defaultTargetAlias]; !ok {
+			return "", storageTarget{}, newAPIError(http.StatusBadRequest, codeUnknownTarget, "no default target, name one or set STORE_TARGET")
+		}
+		alias = defaultTargetAlias
+	}
+	target, ok := targets[alias]
+	if !ok {
+		return alias, target, newAPIError(http.StatusBadRequest, codeUnknownTarget, "unknown target %q", alias)
+	}
+	return alias, target, nil
+}
+
+// targetConfig returns the store configuration of table on target.
+func targetConfig(target storageTarget, table string) (core.StoreConfig, *apiError) {
+	config := core.StoreConfig{
+		Backend: storeBackend,
+		Table:   table,
+		Path:    storePath,
+	}
+	if storeBackend != core.StoreTable {
+		return config, nil
+	}
+
+	config.CreateTable = target.CreateTable
+	config.Endpoint = target.Endpoint
+	var err error
+	if config.Endpoint == "" && target.Auth != credentialConnectionString {
+		config.Endpoint, err = core.TableEndpoint(target.Service, target.Account)
+	}
+	if err == nil {
+		switch target.Auth {
+		case credentialConnectionString:
+			if target.ConnectionString == "" {
+				err = fmt.Errorf("target has no connection string")
+			}
+			config.ConnectionString = target.ConnectionString
+		case credentialDefault:
+			config.Credential, err = azidentity.NewDefaultAzureCredential(nil)
+		case "", credentialSecret:
+			config.Credential, err = azidentity.NewClientSecretCredential(tenantid, account, secret, nil)
+		default:
+			err = fmt.Errorf("unknown auth %q", target.Auth)
+		}
+	}
+	if err != nil {
+		return config, newAPIError(http.StatusInternalServerError, codeCredentialFailed, "%v", err)
+	}
+	return config, nil
+}
+
+// openStore opens the news store of the target named alias.
+func openStore(alias string) (core.NewsStore, *apiError) {
+	_, target, apiErr := lookupTarget(alias)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	config, apiErr := targetConfig(target, target.Table)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	store, err := core.OpenStore(config)
+	if err != nil {
+		return nil, newAPIError(http.StatusServiceUnavailable, codeStoreUnavailable, "%v", err)
+	}
+	return store, nil
+}
+
+// openIngestTarget opens the stores an ingestion into the target named
+// alias writes to: its news store, the state of its feeds and its index of
+// duplicate items, all kept next to it. The returned target has no URL.
+func openIngestTarget(alias string) (core.IngestTarget, *apiError) {
+	alias, target, apiErr := lookupTarget(alias)
+	if apiErr != nil {
+		return core.IngestTarget{}, apiErr
+	}
+	ingestTarget := core.IngestTarget{Name: alias}
+	config, apiErr := targetConfig(target, target.Table)
+	if apiErr != nil {
+		return ingestTarget, apiErr
+	}
+	var err error
+	if ingestTarget.Store, err = core.OpenStore(config); err != nil {
+		return ingestTarget, newAPIError(http.StatusServiceUnavailable, codeStoreUnavailable, "%v", err)
+	}
+	config.Table = feedStateTable
+	if ingestTarget.States, err = core.OpenFeedStateStore(config); err != nil {
+		return ingestTarget, newAPIError(http.StatusServiceUnavailable, codeStoreUnavailable, "%v", err)
+	}
+	// An empty DEDUP_TABLE disables duplicate detection.
+	if dedupTable != "" {
+		config.Table = dedupTable
+		if ingestTarget.Duplicates, err = core.OpenDuplicateIndex(config); err != nil {
+			return ingestTarget, newAPIError(http.StatusServiceUnavailable, codeStoreUnavailable, "%v", err)
+		}
+	}
+	return ingestTarget, nil
+}
+
+// openRegistry opens the feed registry, kept next to the default target.
+func openRegistry() (core.FeedRegistry, *apiError) {
+	_, target, apiErr := lookupTarget("")
+	if apiErr != nil && apiErr.Code == codeUnknownTarget {
+		return nil, newAPIError(http.StatusInternalServerError, codeStoreUnavailable, "the feed registry is kept next to the default target: set STORE_TARGET")
+	}
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	config, apiErr := targetConfig(target, feedsTable)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	registry, err := core.OpenFeedRegistry(config)
+	if err != nil {
+		return nil, newAPIError(http.StatusServiceUnavailable, codeStoreUnavailable, "%v", err)
+	}
+	return registry, nil
+}
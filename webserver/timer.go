@@ -0,0 +1,97 @@
+package main
+
+import (
+	"azure/core"
+	"context"
+	"fmt"
+)
+
+type timerInfo struct {
+	IsPastDue bool `json:"IsPastDue"`
+}
+
+// runTimer handles TimerTrigger1. It ingests the feeds listed in
+// SCHEDULED_FEEDS into the default target and every due feed of the
+// registry; the results are the ReturnValue. With INGEST_MODE="queue" the
+// feeds are queued for QueueTrigger1 instead.
+func runTimer(ctx context.Context, inv *invocation) error {
+	var timer timerInfo
+	if err := inv.Bind("timer", &timer); err != nil {
+		return err
+	}
+	if timer.IsPastDue {
+		inv.Logf("timer is past due")
+	}
+
+	if ingestMode == ingestModeQueue {
+		return enqueueScheduled(ctx, inv)
+	}
+	var results []feedResult
+	if len(scheduledFeeds) > 0 {
+		postRequest := POSTRequest{}
+		for _, feedURL := range scheduledFeeds {
+			postRequest.Feeds = append(postRequest.Feeds, FeedRequest{Url: feedURL})
+		}
+		results = append(results, ingestMany(ctx, postRequest)...)
+	}
+	due, apiErr := dueResults(ctx)
+	if apiErr != nil {
+		inv.Logf("registry: %v", apiErr)
+	}
+	results = append(results, due...)
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != nil {
+			failed++
+			inv.Logf("%s: %v", result.URL, result.Error)
+			continue
+		}
+		inv.Logf("%s: %s", result.URL, summary(result.IngestReport))
+	}
+	inv.Logf("ingested %d feeds, %d failed", len(results), failed)
+	inv.ReturnValue = map[string][]feedResult{"results": results}
+
+	// Only a broken registry with nothing else to ingest fails the run, so
+	// that the host reports it.
+	if apiErr != nil && len(results) == 0 {
+		return apiErr
+	}
+	return nil
+}
+
+func summary(report core.IngestReport) string {
+	if report.Skipped != "" {
+		return "skipped, " + report.Skipped
+	}
+	return fmt.Sprintf("%d inserted, %d duplicates, %d failed", report.Inserted, report.Duplicates, report.Failed)
+}
+
+func enqueueScheduled(ctx context.Context, inv *invocation) error {
+	var messages []core.IngestMessage
+	if len(scheduledFeeds) > 0 {
+		postRequest := POSTRequest{}
+		for _, feedURL := range scheduledFeeds {
+			postRequest.Feeds = append(postRequest.Feeds, FeedRequest{Url: feedURL})
+		}
+		scheduled, apiErr := ingestMessages(ctx, postRequest)
+		if apiErr != nil {
+			inv.Logf("SCHEDULED_FEEDS: %v", apiErr)
+		}
+		messages = append(messages, scheduled...)
+	}
+	due, apiErr := ingestMessages(ctx, POSTRequest{})
+	if apiErr != nil {
+		inv.Logf("registry: %v", apiErr)
+	}
+	messages = append(messages, due...)
+
+	if len(messages) > 0 {
+		inv.Outputs[queueOutput] = messages
+	}
+	inv.Logf("queued %d feeds", len(messages))
+	if apiErr != nil && len(messages) == 0 {
+		return apiErr
+	}
+	return nil
+}